@@ -2,6 +2,11 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/komuw/cali/token"
 )
@@ -9,10 +14,12 @@ import (
 /*
  Every node in our AST has to implement the Node interface.
  TokenValue() is only used for debugging.
+ Pos() is the position in the source code where the node starts; so that errors can point at it.
 */
 type Node interface {
 	TokenValue() string
 	String() string // makes debugging easy
+	Pos() token.Position
 }
 
 type Statement interface {
@@ -41,6 +48,12 @@ func (p *Program) TokenValue() string {
 		return ""
 	}
 }
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range p.Statements {
@@ -61,11 +74,13 @@ The fields its(AST) should have are;
 
 Example of LetStatement struct for; let x = 5;
 	&ast.LetStatement{
-		Token: token.Token{Type: "LET", Value: "let"},
+		Token: token.Token{Type: token.LET, Value: "let"},
 		Name: &ast.Identifier{
-			Token: token.Token{Type: "IDENT", Value: "x", },
+			Token: token.Token{Type: token.IDENT, Value: "x", },
 			Value: "x"},
-		Value: nil, // TODO: update this to reflect that Value should be 5 when we start parsing INTs
+		Value: &ast.IntegerLiteral{
+			Token: token.Token{Type: token.INT, Value: "5"},
+			Value: 5},
 	}
 
 let x = 5;
@@ -90,6 +105,7 @@ func (ls *LetStatement) statementNode() {}
 func (ls *LetStatement) TokenValue() string {
 	return ls.Token.Value
 }
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenValue() + " ")
@@ -111,7 +127,7 @@ It has fields;
 
 Example of Identifier struct for; let x = 5;
 	&ast.Identifier{
-			Token: token.Token{Type: "IDENT", Value: "x", },
+			Token: token.Token{Type: token.IDENT, Value: "x", },
 			Value: "x"
 		}
 */
@@ -124,7 +140,8 @@ type Identifier struct {
 func (i *Identifier) expressionNode() {}
 
 // TokenValue implements the Node interface
-func (i *Identifier) TokenValue() string { return i.Token.Value }
+func (i *Identifier) TokenValue() string  { return i.Token.Value }
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -141,8 +158,9 @@ type ReturnStatement struct {
 	ReturnValue Expression
 }
 
-func (rs *ReturnStatement) statementNode()     {}
-func (rs *ReturnStatement) TokenValue() string { return rs.Token.Value }
+func (rs *ReturnStatement) statementNode()      {}
+func (rs *ReturnStatement) TokenValue() string  { return rs.Token.Value }
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Pos }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(rs.TokenValue() + " ")
@@ -167,25 +185,295 @@ type ExpressionStatement struct {
 	Expression Expression  // holds the expression
 }
 
-func (es *ExpressionStatement) statementNode()     {}
-func (es *ExpressionStatement) TokenValue() string { return es.Token.Value }
+func (es *ExpressionStatement) statementNode()      {}
+func (es *ExpressionStatement) TokenValue() string  { return es.Token.Value }
+func (es *ExpressionStatement) Pos() token.Position { return es.Token.Pos }
+
+/*
+String ends the expression with a ; like LetStatement and ReturnStatement do, so that the String of a Program can be
+parsed again; see Equal. Except for an if, which like a block needs no ;
+
+An if at the start of a statement is parsed as a statement of its own(see parser.parseExpressionStatement);
+so an expression that starts with one, like if (x) { f; } else { g; }(1), is put in parentheses.
+*/
 func (es *ExpressionStatement) String() string {
-	if es.Expression != nil {
-		return es.Expression.String()
+	if es.Expression == nil {
+		return ""
+	}
+	s := es.Expression.String()
+	if _, ok := es.Expression.(*IfExpression); ok {
+		return s
 	}
-	return ""
+	if strings.HasPrefix(s, "if ") {
+		s = "(" + s + ")"
+	}
+	return s + ";"
 }
 
 /*
 IntegerLiteral satisfies Expression interface.
 Value is an int64 and not a string.
 This is the field containing the actual value the integer literal represents.
+Literals that do not fit in an int64, like 99999999999999999999, are stored in Big instead and Value is 0.
 */
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int
+}
+
+func (il *IntegerLiteral) expressionNode()     {}
+func (il *IntegerLiteral) TokenValue() string  { return il.Token.Value }
+func (il *IntegerLiteral) Pos() token.Position { return il.Token.Pos }
+func (il *IntegerLiteral) String() string      { return il.Token.Value }
+
+/*
+FloatLiteral satisfies Expression interface.
+Like IntegerLiteral, Value is the actual value the literal represents; 4.2e1 has a Value of 42.
+*/
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()     {}
+func (fl *FloatLiteral) TokenValue() string  { return fl.Token.Value }
+func (fl *FloatLiteral) Pos() token.Position { return fl.Token.Pos }
+func (fl *FloatLiteral) String() string      { return fl.Token.Value }
+
+/*
+PrefixExpression satisfies Expression interface.
+It is used to represent expressions with a prefix operator like;
+	-5;
+	!foobar;
+The usage of prefix operator expressions is;
+	<prefix operator><expression>;
+Right is the expression to the right of the operator.
+*/
+type PrefixExpression struct {
+	Token    token.Token // The prefix token, e.g. ! or -
+	Operator string
+	Right    Expression
+}
+
+func (pe *PrefixExpression) expressionNode()     {}
+func (pe *PrefixExpression) TokenValue() string  { return pe.Token.Value }
+func (pe *PrefixExpression) Pos() token.Position { return pe.Token.Pos }
+
+// String deliberately adds parentheses around the operator and its operand, so that we can see which operands belong to which operator.
+func (pe *PrefixExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(pe.Operator)
+	out.WriteString(pe.Right.String())
+	out.WriteString(")")
+	return out.String()
+}
+
+/*
+InfixExpression satisfies Expression interface.
+It is used to represent expressions with an infix operator like;
+	5 + 5;
+	x == y;
+The usage of infix operator expressions is;
+	<expression> <infix operator> <expression>;
+Infix operators are binary since they have two operands, Left and Right.
+*/
+type InfixExpression struct {
+	Token    token.Token // The operator token, e.g. +
+	Left     Expression
+	Operator string
+	Right    Expression
+}
+
+func (ie *InfixExpression) expressionNode()    {}
+func (ie *InfixExpression) TokenValue() string { return ie.Token.Value }
+
+// Pos of an infix expression is where its left operand starts; ie.Token.Pos is where the operator is.
+func (ie *InfixExpression) Pos() token.Position { return ie.Left.Pos() }
+func (ie *InfixExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString(" " + ie.Operator + " ")
+	out.WriteString(ie.Right.String())
+	out.WriteString(")")
+	return out.String()
+}
+
+/*
+BlockStatement satisfies Statement interface.
+It is a series of statements enclosed in braces, like the body of a function;
+	{ x + y; }
+*/
+type BlockStatement struct {
+	Token      token.Token // the { token
+	Statements []Statement
+	Rbrace     token.Token // the } token; so that tools know where the block ends
+}
+
+func (bs *BlockStatement) statementNode()      {}
+func (bs *BlockStatement) TokenValue() string  { return bs.Token.Value }
+func (bs *BlockStatement) Pos() token.Position { return bs.Token.Pos }
+func (bs *BlockStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("{ ")
+	for _, s := range bs.Statements {
+		out.WriteString(s.String())
+		out.WriteString(" ")
+	}
+	out.WriteString("}")
+	return out.String()
 }
 
-func (il *IntegerLiteral) expressionNode()    {}
-func (il *IntegerLiteral) TokenValue() string { return il.Token.Value }
-func (il *IntegerLiteral) String() string     { return il.Token.Value }
+/*
+FunctionLiteral satisfies Expression interface.
+Function literals look like;
+	fn(x, y) { x + y; }
+ie;
+	fn <parameters> <block statement>
+where parameters is a comma separated list of identifiers enclosed in parentheses.
+Function literals are expressions, so they can be used wherever an expression is allowed; eg let add = fn(x, y) { x + y; };
+*/
+type FunctionLiteral struct {
+	Token      token.Token // The 'fn' token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (fl *FunctionLiteral) expressionNode()     {}
+func (fl *FunctionLiteral) TokenValue() string  { return fl.Token.Value }
+func (fl *FunctionLiteral) Pos() token.Position { return fl.Token.Pos }
+func (fl *FunctionLiteral) String() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range fl.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString(fl.TokenValue())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(fl.Body.String())
+	return out.String()
+}
+
+/*
+CallExpression satisfies Expression interface.
+Call expressions look like;
+	add(2, 3);
+ie;
+	<expression>(<comma separated expressions>)
+Function is whatever evaluates to a function; an identifier like add or even a function literal like; fn(x) { x; }(5);
+*/
+type CallExpression struct {
+	Token     token.Token // The '(' token
+	Function  Expression  // Identifier or FunctionLiteral
+	Arguments []Expression
+	Rparen    token.Token // The ')' token; so that tools know where the call ends
+}
+
+func (ce *CallExpression) expressionNode()    {}
+func (ce *CallExpression) TokenValue() string { return ce.Token.Value }
+
+// Pos of a call expression is where the function starts; ce.Token.Pos is where the ( is.
+func (ce *CallExpression) Pos() token.Position { return ce.Function.Pos() }
+func (ce *CallExpression) String() string {
+	var out bytes.Buffer
+	args := []string{}
+	for _, a := range ce.Arguments {
+		args = append(args, a.String())
+	}
+	out.WriteString(ce.Function.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+	return out.String()
+}
+
+// Boolean satisfies Expression interface. It is either true or false.
+type Boolean struct {
+	Token token.Token
+	Value bool
+}
+
+func (b *Boolean) expressionNode()     {}
+func (b *Boolean) TokenValue() string  { return b.Token.Value }
+func (b *Boolean) Pos() token.Position { return b.Token.Pos }
+func (b *Boolean) String() string      { return b.Token.Value }
+
+/*
+IfExpression satisfies Expression interface.
+In cali, if/else is an expression; it produces a value. So we can do;
+	let max = if (x > y) { x; } else { y; };
+Alternative is nil when there is no else.
+*/
+type IfExpression struct {
+	Token       token.Token // The 'if' token
+	Condition   Expression
+	Consequence *BlockStatement
+	Alternative *BlockStatement
+}
+
+func (ie *IfExpression) expressionNode()     {}
+func (ie *IfExpression) TokenValue() string  { return ie.Token.Value }
+func (ie *IfExpression) Pos() token.Position { return ie.Token.Pos }
+func (ie *IfExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("if (")
+	out.WriteString(ie.Condition.String())
+	out.WriteString(") ")
+	out.WriteString(ie.Consequence.String())
+	if ie.Alternative != nil {
+		out.WriteString(" else ")
+		out.WriteString(ie.Alternative.String())
+	}
+	return out.String()
+}
+
+/*
+StringLiteral satisfies Expression interface.
+Value is the content of the string, with its escape sequences already replaced by the lexer; "a\tb" has a Value of a<TAB>b
+*/
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()     {}
+func (sl *StringLiteral) TokenValue() string  { return sl.Token.Value }
+func (sl *StringLiteral) Pos() token.Position { return sl.Token.Pos }
+
+// String returns the string as it would be written in cali source code; quoted and with escape sequences.
+func (sl *StringLiteral) String() string { return quote(sl.Value) }
+
+/*
+quote is the inverse of what the lexer does to string literals.
+A string that is not valid UTF-8 is quoted byte by byte where it is not; as \x escapes, so that no byte is lost.
+*/
+func quote(s string) string {
+	var out bytes.Buffer
+	out.WriteByte('"')
+	for i := 0; i < len(s); {
+		ch, width := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case ch == utf8.RuneError && width == 1:
+			fmt.Fprintf(&out, `\x%02X`, s[i])
+		case ch == '"':
+			out.WriteString(`\"`)
+		case ch == '\\':
+			out.WriteString(`\\`)
+		case ch == '\n':
+			out.WriteString(`\n`)
+		case ch == '\t':
+			out.WriteString(`\t`)
+		case unicode.IsPrint(ch):
+			out.WriteRune(ch)
+		default:
+			fmt.Fprintf(&out, `\u{%X}`, ch)
+		}
+		i += width
+	}
+	out.WriteByte('"')
+	return out.String()
+}
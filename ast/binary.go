@@ -0,0 +1,632 @@
+package ast
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/komuw/cali/token"
+)
+
+/*
+BINARY ENCODING
+
+MarshalBinary and UnmarshalBinary turn a *Program into bytes and back, so that parsed programs can be
+stored(see package cache) or sent to another process without lexing and parsing the source code again.
+Everything is kept; every node, every token and every position.
+
+The format is;
+
+	"CALI" version program
+
+version is a single byte, binaryVersion. Decoding fails for any other version.
+All ints are varints(see encoding/binary); the end of a token is written relative to its start. Strings are interned; the first time a string appears it is written
+as its index in the string table(which is then the length of the table) followed by its length and bytes,
+after that only the index is written. That way a filename, which is part of every position, is only written once.
+
+A node starts with a tag byte(see the node* constants) that tells what kind of node it is. A nil node is just nodeNil.
+It is followed by its fields, in the order they are declared in the node's struct.
+Slices are written as their length + 1 followed by the elements, and a nil slice as 0.
+
+Programs nested more than MaxDepth nodes deep can not be encoded or decoded.
+*/
+
+// binaryMagic starts every binary encoded program.
+const binaryMagic = "CALI"
+
+/*
+binaryVersion is the version of the format. Bump it whenever the format changes,
+eg when a node or a field is added; old encodings can then no longer be decoded.
+*/
+const binaryVersion = 2
+
+// the tags of the nodes.
+const (
+	nodeNil byte = iota
+	nodeLetStatement
+	nodeReturnStatement
+	nodeExpressionStatement
+	nodeBlockStatement
+	nodeIdentifier
+	nodeIntegerLiteral
+	nodeFloatLiteral
+	nodeStringLiteral
+	nodeBoolean
+	nodePrefixExpression
+	nodeInfixExpression
+	nodeIfExpression
+	nodeFunctionLiteral
+	nodeCallExpression
+)
+
+var (
+	errNotBinary = errors.New("ast: not a binary encoded program")
+	errTruncated = errors.New("ast: binary encoded program is truncated")
+	errTooDeep   = fmt.Errorf("ast: program is nested more than %d nodes deep", MaxDepth)
+)
+
+/*
+MaxDepth is how deep the nodes of a program can be nested for it to be encoded; in both the binary and the JSON encoding.
+A statement of the program is at depth 1, its children at depth 2 and so on.
+The encoders and decoders recurse, so without a limit a crafted input could make them use any amount of stack.
+The JSON of a node nests at most 2 levels deeper than that of its parent, so the JSON of a program that is MaxDepth
+deep is still less deep than the 10000 levels that encoding/json can handle.
+The parser does make deeper programs(eg a sum of thousands of numbers); the AST cache does not store those.
+*/
+const MaxDepth = 4000
+
+// MarshalBinary encodes the program; see BINARY ENCODING. It implements encoding.BinaryMarshaler
+func (p *Program) MarshalBinary() ([]byte, error) {
+	e := &encoder{strings: make(map[string]int)}
+	e.buf = append(e.buf, binaryMagic...)
+	e.buf = append(e.buf, binaryVersion)
+	e.statements(p.Statements)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.buf, nil
+}
+
+/*
+UnmarshalBinary decodes data, as produced by MarshalBinary, into p. It implements encoding.BinaryUnmarshaler
+It returns an error for data that is not a binary encoded program, that is truncated or that is of another version.
+It also returns one for a program that the parser could not have made; one with nil nodes where the parser always puts
+one(eg the Name of a LetStatement). String and eval.Eval rely on those, and would crash on such a program.
+*/
+func (p *Program) UnmarshalBinary(data []byte) (err error) {
+	if len(data) < len(binaryMagic)+1 || string(data[:len(binaryMagic)]) != binaryMagic {
+		return errNotBinary
+	}
+	if v := data[len(binaryMagic)]; v != binaryVersion {
+		return fmt.Errorf("ast: unsupported binary format version %d, want %d", v, binaryVersion)
+	}
+
+	/*
+		the decoder panics with a decodeError on bad input, instead of every method returning an error
+		that all the callers have to check. We turn it back into an error here.
+	*/
+	defer func() {
+		if r := recover(); r != nil {
+			de, ok := r.(decodeError)
+			if !ok {
+				panic(r)
+			}
+			err = de.err
+		}
+	}()
+	d := &decoder{buf: data[len(binaryMagic)+1:]}
+	statements := d.statements("Program.Statements")
+	if len(d.buf) != 0 {
+		return fmt.Errorf("ast: %d unexpected bytes after binary encoded program", len(d.buf))
+	}
+	p.Statements = statements
+	return nil
+}
+
+type encoder struct {
+	buf     []byte
+	strings map[string]int // index of every string in the string table
+	err     error          // the first node that could not be encoded; see MarshalBinary
+	depth   int            // how many nodes the node being encoded is in
+}
+
+func (e *encoder) uint(v uint64) { e.buf = binary.AppendUvarint(e.buf, v) }
+func (e *encoder) int(v int64)   { e.buf = binary.AppendVarint(e.buf, v) }
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	if i, ok := e.strings[s]; ok {
+		e.uint(uint64(i))
+		return
+	}
+	i := len(e.strings)
+	e.strings[s] = i
+	e.uint(uint64(i))
+	e.uint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) position(p token.Position) {
+	e.string(p.Filename)
+	e.uint(uint64(p.Offset))
+	e.uint(uint64(p.Line))
+	e.uint(uint64(p.Column))
+}
+
+// token writes t. Its End is written as the difference from its Pos; which is small, and so takes fewer bytes.
+func (e *encoder) token(t token.Token) {
+	e.uint(uint64(t.Type))
+	e.string(t.Value)
+	e.position(t.Pos)
+	e.string(t.End.Filename)
+	e.int(int64(t.End.Offset - t.Pos.Offset))
+	e.int(int64(t.End.Line - t.Pos.Line))
+	e.int(int64(t.End.Column - t.Pos.Column))
+}
+
+// sliceLen writes the length of a slice; see BINARY ENCODING
+func (e *encoder) sliceLen(isNil bool, n int) {
+	if isNil {
+		e.uint(0)
+		return
+	}
+	e.uint(uint64(n) + 1)
+}
+
+func (e *encoder) statements(stmts []Statement) {
+	e.sliceLen(stmts == nil, len(stmts))
+	for _, s := range stmts {
+		e.node(s)
+	}
+}
+
+func (e *encoder) expressions(exps []Expression) {
+	e.sliceLen(exps == nil, len(exps))
+	for _, x := range exps {
+		e.node(x)
+	}
+}
+
+// block writes a *BlockStatement field; it is a separate method since a nil *BlockStatement is not a nil Node.
+func (e *encoder) block(b *BlockStatement) {
+	if b == nil {
+		e.buf = append(e.buf, nodeNil)
+		return
+	}
+	e.node(b)
+}
+
+func (e *encoder) identifier(i *Identifier) {
+	if i == nil {
+		e.buf = append(e.buf, nodeNil)
+		return
+	}
+	e.node(i)
+}
+
+func (e *encoder) node(n Node) {
+	if isNil(n) {
+		e.buf = append(e.buf, nodeNil)
+		return
+	}
+	if e.depth == MaxDepth {
+		if e.err == nil {
+			e.err = errTooDeep
+		}
+		e.buf = append(e.buf, nodeNil)
+		return
+	}
+	e.depth++
+	switch n := n.(type) {
+	case *LetStatement:
+		e.buf = append(e.buf, nodeLetStatement)
+		e.token(n.Token)
+		e.identifier(n.Name)
+		e.node(n.Value)
+	case *ReturnStatement:
+		e.buf = append(e.buf, nodeReturnStatement)
+		e.token(n.Token)
+		e.node(n.ReturnValue)
+	case *ExpressionStatement:
+		e.buf = append(e.buf, nodeExpressionStatement)
+		e.token(n.Token)
+		e.node(n.Expression)
+	case *BlockStatement:
+		e.buf = append(e.buf, nodeBlockStatement)
+		e.token(n.Token)
+		e.statements(n.Statements)
+		e.token(n.Rbrace)
+	case *Identifier:
+		e.buf = append(e.buf, nodeIdentifier)
+		e.token(n.Token)
+		e.string(n.Value)
+	case *IntegerLiteral:
+		e.buf = append(e.buf, nodeIntegerLiteral)
+		e.token(n.Token)
+		e.int(n.Value)
+		e.bool(n.Big != nil)
+		if n.Big != nil {
+			e.bool(n.Big.Sign() < 0)
+			abs := n.Big.Bytes()
+			e.uint(uint64(len(abs)))
+			e.buf = append(e.buf, abs...)
+		}
+	case *FloatLiteral:
+		e.buf = append(e.buf, nodeFloatLiteral)
+		e.token(n.Token)
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(n.Value))
+	case *StringLiteral:
+		e.buf = append(e.buf, nodeStringLiteral)
+		e.token(n.Token)
+		e.string(n.Value)
+	case *Boolean:
+		e.buf = append(e.buf, nodeBoolean)
+		e.token(n.Token)
+		e.bool(n.Value)
+	case *PrefixExpression:
+		e.buf = append(e.buf, nodePrefixExpression)
+		e.token(n.Token)
+		e.string(n.Operator)
+		e.node(n.Right)
+	case *InfixExpression:
+		e.buf = append(e.buf, nodeInfixExpression)
+		e.token(n.Token)
+		e.node(n.Left)
+		e.string(n.Operator)
+		e.node(n.Right)
+	case *IfExpression:
+		e.buf = append(e.buf, nodeIfExpression)
+		e.token(n.Token)
+		e.node(n.Condition)
+		e.block(n.Consequence)
+		e.block(n.Alternative)
+	case *FunctionLiteral:
+		e.buf = append(e.buf, nodeFunctionLiteral)
+		e.token(n.Token)
+		e.sliceLen(n.Parameters == nil, len(n.Parameters))
+		for _, param := range n.Parameters {
+			e.identifier(param)
+		}
+		e.block(n.Body)
+	case *CallExpression:
+		e.buf = append(e.buf, nodeCallExpression)
+		e.token(n.Token)
+		e.node(n.Function)
+		e.expressions(n.Arguments)
+		e.token(n.Rparen)
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("ast: can not encode node of type %T", n)
+		}
+	}
+	e.depth--
+}
+
+// decodeError is what the decoder panics with; see Program.UnmarshalBinary
+type decodeError struct{ err error }
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	panic(decodeError{fmt.Errorf("ast: "+format, a...)})
+}
+
+type decoder struct {
+	buf     []byte
+	strings []string
+	depth   int // how many nodes the node being decoded is in
+}
+
+func (d *decoder) byte() byte {
+	if len(d.buf) == 0 {
+		panic(decodeError{errTruncated})
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) bytes(n uint64) []byte {
+	if n > uint64(len(d.buf)) {
+		panic(decodeError{errTruncated})
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) uint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		panic(decodeError{errTruncated})
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) int() int64 {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		panic(decodeError{errTruncated})
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+// smallInt reads an int that is part of a position, or a token type.
+func (d *decoder) smallInt() int {
+	v := d.uint()
+	if v > math.MaxInt32 {
+		d.fail("int %d out of range", v)
+	}
+	return int(v)
+}
+
+// relativeInt reads an int that is part of a position and was written as the difference from base; see encoder.token
+func (d *decoder) relativeInt(base int) int {
+	v := int64(base) + d.int()
+	if v < 0 || v > math.MaxInt32 {
+		d.fail("int %d out of range", v)
+	}
+	return int(v)
+}
+
+func (d *decoder) bool() bool {
+	switch b := d.byte(); b {
+	case 0:
+		return false
+	case 1:
+		return true
+	default:
+		d.fail("invalid bool %d", b)
+		return false
+	}
+}
+
+func (d *decoder) string() string {
+	i := d.uint()
+	switch {
+	case i < uint64(len(d.strings)):
+		return d.strings[i]
+	case i == uint64(len(d.strings)):
+		s := string(d.bytes(d.uint()))
+		d.strings = append(d.strings, s)
+		return s
+	default:
+		d.fail("string %d is not in the string table", i)
+		return ""
+	}
+}
+
+func (d *decoder) position() token.Position {
+	return token.Position{
+		Filename: d.string(),
+		Offset:   d.smallInt(),
+		Line:     d.smallInt(),
+		Column:   d.smallInt(),
+	}
+}
+
+func (d *decoder) token() token.Token {
+	t := token.Token{Type: token.TokenType(d.smallInt())}
+	if t.Type >= token.NumTokens {
+		d.fail("unknown token type %d", int(t.Type))
+	}
+	t.Value = d.string()
+	t.Pos = d.position()
+	t.End = token.Position{
+		Filename: d.string(),
+		Offset:   d.relativeInt(t.Pos.Offset),
+		Line:     d.relativeInt(t.Pos.Line),
+		Column:   d.relativeInt(t.Pos.Column),
+	}
+	return t
+}
+
+/*
+sliceLen reads the length of a slice; see BINARY ENCODING
+Every element takes at least one byte, so a length that is more than the bytes left is bad input.
+Checking that here keeps us from allocating huge slices for it.
+*/
+func (d *decoder) sliceLen() (n int, isNil bool) {
+	v := d.uint()
+	if v == 0 {
+		return 0, true
+	}
+	if v-1 > uint64(len(d.buf)) {
+		panic(decodeError{errTruncated})
+	}
+	return int(v - 1), false
+}
+
+// statements reads a list of statements; field is the name of the list, for errors.
+func (d *decoder) statements(field string) []Statement {
+	n, isNil := d.sliceLen()
+	if isNil {
+		return nil
+	}
+	stmts := make([]Statement, n)
+	for i := range stmts {
+		if stmts[i] = d.statement(); stmts[i] == nil {
+			d.fail("%s[%d] is nil", field, i)
+		}
+	}
+	return stmts
+}
+
+func (d *decoder) expressions(field string) []Expression {
+	n, isNil := d.sliceLen()
+	if isNil {
+		return nil
+	}
+	exps := make([]Expression, n)
+	for i := range exps {
+		if exps[i] = d.expression(); exps[i] == nil {
+			d.fail("%s[%d] is nil", field, i)
+		}
+	}
+	return exps
+}
+
+func (d *decoder) statement() Statement {
+	n := d.node()
+	if n == nil {
+		return nil
+	}
+	s, ok := n.(Statement)
+	if !ok {
+		d.fail("%T is not a statement", n)
+	}
+	return s
+}
+
+func (d *decoder) expression() Expression {
+	n := d.node()
+	if n == nil {
+		return nil
+	}
+	x, ok := n.(Expression)
+	if !ok {
+		d.fail("%T is not an expression", n)
+	}
+	return x
+}
+
+func (d *decoder) block() *BlockStatement {
+	n := d.node()
+	if n == nil {
+		return nil
+	}
+	b, ok := n.(*BlockStatement)
+	if !ok {
+		d.fail("%T is not a block statement", n)
+	}
+	return b
+}
+
+func (d *decoder) identifier() *Identifier {
+	n := d.node()
+	if n == nil {
+		return nil
+	}
+	i, ok := n.(*Identifier)
+	if !ok {
+		d.fail("%T is not an identifier", n)
+	}
+	return i
+}
+
+/*
+The required funcs read the fields that the parser never leaves nil; field is the name of the field, for errors.
+The only field that can be nil is the Alternative of an IfExpression.
+*/
+
+func (d *decoder) requiredExpression(field string) Expression {
+	x := d.expression()
+	if x == nil {
+		d.fail("%s is nil", field)
+	}
+	return x
+}
+
+func (d *decoder) requiredBlock(field string) *BlockStatement {
+	b := d.block()
+	if b == nil {
+		d.fail("%s is nil", field)
+	}
+	return b
+}
+
+func (d *decoder) requiredIdentifier(field string) *Identifier {
+	i := d.identifier()
+	if i == nil {
+		d.fail("%s is nil", field)
+	}
+	return i
+}
+
+func (d *decoder) node() Node {
+	tag := d.byte()
+	if tag == nodeNil {
+		return nil
+	}
+	if d.depth == MaxDepth {
+		panic(decodeError{errTooDeep})
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+
+	switch tag {
+	case nodeLetStatement:
+		return &LetStatement{Token: d.token(), Name: d.requiredIdentifier("LetStatement.Name"), Value: d.requiredExpression("LetStatement.Value")}
+	case nodeReturnStatement:
+		return &ReturnStatement{Token: d.token(), ReturnValue: d.requiredExpression("ReturnStatement.ReturnValue")}
+	case nodeExpressionStatement:
+		return &ExpressionStatement{Token: d.token(), Expression: d.requiredExpression("ExpressionStatement.Expression")}
+	case nodeBlockStatement:
+		return &BlockStatement{Token: d.token(), Statements: d.statements("BlockStatement.Statements"), Rbrace: d.token()}
+	case nodeIdentifier:
+		return &Identifier{Token: d.token(), Value: d.string()}
+	case nodeIntegerLiteral:
+		il := &IntegerLiteral{Token: d.token(), Value: d.int()}
+		if d.bool() {
+			negative := d.bool()
+			il.Big = new(big.Int).SetBytes(d.bytes(d.uint()))
+			if negative {
+				il.Big.Neg(il.Big)
+			}
+		}
+		return il
+	case nodeFloatLiteral:
+		fl := &FloatLiteral{Token: d.token()}
+		fl.Value = math.Float64frombits(binary.LittleEndian.Uint64(d.bytes(8)))
+		return fl
+	case nodeStringLiteral:
+		return &StringLiteral{Token: d.token(), Value: d.string()}
+	case nodeBoolean:
+		return &Boolean{Token: d.token(), Value: d.bool()}
+	case nodePrefixExpression:
+		return &PrefixExpression{Token: d.token(), Operator: d.string(), Right: d.requiredExpression("PrefixExpression.Right")}
+	case nodeInfixExpression:
+		return &InfixExpression{
+			Token:    d.token(),
+			Left:     d.requiredExpression("InfixExpression.Left"),
+			Operator: d.string(),
+			Right:    d.requiredExpression("InfixExpression.Right"),
+		}
+	case nodeIfExpression:
+		return &IfExpression{
+			Token:       d.token(),
+			Condition:   d.requiredExpression("IfExpression.Condition"),
+			Consequence: d.requiredBlock("IfExpression.Consequence"),
+			Alternative: d.block(),
+		}
+	case nodeFunctionLiteral:
+		fl := &FunctionLiteral{Token: d.token()}
+		if n, isNil := d.sliceLen(); !isNil {
+			fl.Parameters = make([]*Identifier, n)
+			for i := range fl.Parameters {
+				fl.Parameters[i] = d.requiredIdentifier(fmt.Sprintf("FunctionLiteral.Parameters[%d]", i))
+			}
+		}
+		fl.Body = d.requiredBlock("FunctionLiteral.Body")
+		return fl
+	case nodeCallExpression:
+		return &CallExpression{
+			Token:     d.token(),
+			Function:  d.requiredExpression("CallExpression.Function"),
+			Arguments: d.expressions("CallExpression.Arguments"),
+			Rparen:    d.token(),
+		}
+	default:
+		d.fail("unknown node tag %d", tag)
+		return nil
+	}
+}
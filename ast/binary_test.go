@@ -0,0 +1,219 @@
+package ast_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/komuw/cali/ast"
+	"github.com/komuw/cali/lexer"
+	"github.com/komuw/cali/parser"
+	"github.com/komuw/cali/token"
+)
+
+const binaryTestInput = `let add = fn(x, y) { return x + y; };
+let s = "jambo\n名前 \u{1F600}";
+let f = fn() { };
+if (add(1, 2.5) > 3) { -0x2A; } else { 99999999999999999999 * -99999999999999999999; }
+if (!true == false) { add(s, "x")(1); }
+let big = -18446744073709551616;
+`
+
+func parse(t *testing.T, filename, input string) *ast.Program {
+	t.Helper()
+	p := parser.NewParser(lexer.NewFileLexer(filename, input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %q", p.Errors())
+	}
+	return program
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	tests := []*ast.Program{
+		parse(t, "main.cali", binaryTestInput),
+		parse(t, "", "5;"),
+		parse(t, "", ""),
+		{},
+	}
+	for _, program := range tests {
+		data, err := program.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := &ast.Program{}
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("\n could not decode %q: %v", program.String(), err)
+		}
+		if !reflect.DeepEqual(decoded, program) {
+			t.Errorf("\n round trip changed the program. \ngot %q \nwanted %q", decoded.String(), program.String())
+		}
+	}
+}
+
+func TestBinaryCompact(t *testing.T) {
+	input := strings.Repeat(binaryTestInput, 100)
+	data, err := parse(t, "a/long/path/to/the/main.cali", input).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the filename is in every position, but it is only written once.
+	if n := strings.Count(string(data), "main.cali"); n != 1 {
+		t.Errorf("\n filename written %d times, wanted once", n)
+	}
+	// positions make up most of the encoding, so it is bigger than the source; but not by much.
+	if len(data) > 4*len(input) {
+		t.Errorf("\n encoding is not compact. \ngot %d bytes for %d bytes of source", len(data), len(input))
+	}
+}
+
+func TestBinaryDecodeErrors(t *testing.T) {
+	data, err := parse(t, "main.cali", binaryTestInput).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		data          []byte
+		expectedError string
+	}{
+		{nil, "ast: not a binary encoded program"},
+		{[]byte("let x = 5;"), "ast: not a binary encoded program"},
+		{append([]byte("CALI\x01"), data[5:]...), "ast: unsupported binary format version 1, want 2"},
+		{data[:len(data)/2], "ast: binary encoded program is truncated"},
+		{append(append([]byte{}, data...), 0), "ast: 1 unexpected bytes after binary encoded program"},
+		{[]byte("CALI\x02\x02\xff"), "ast: unknown node tag 255"},
+		{[]byte("CALI\x02\x02\x05"), "ast: binary encoded program is truncated"},
+	}
+	for _, tt := range tests {
+		err := (&ast.Program{}).UnmarshalBinary(tt.data)
+		if err == nil {
+			t.Errorf("\n no error for %q", tt.data)
+			continue
+		}
+		if err.Error() != tt.expectedError {
+			t.Errorf("\n wrong error for %q. \ngot %q \nwanted %q", tt.data, err, tt.expectedError)
+		}
+	}
+
+	// every prefix of a valid encoding is an error, and never a panic.
+	for i := range data {
+		if err := (&ast.Program{}).UnmarshalBinary(data[:i]); err == nil {
+			t.Errorf("\n no error for the first %d bytes", i)
+		}
+	}
+}
+
+// unknownExpression is an Expression that is not one of the ast package; it gets the methods of one by embedding it.
+type unknownExpression struct{ *ast.Identifier }
+
+/*
+Programs that the parser could not have made are rejected; by MarshalBinary if it can not encode a node, else by
+UnmarshalBinary if a node is nil where the parser always puts one.
+*/
+func TestBinaryInvalidPrograms(t *testing.T) {
+	x := &ast.Identifier{Value: "x"}
+	block := &ast.BlockStatement{}
+	statement := func(e ast.Expression) ast.Statement { return &ast.ExpressionStatement{Expression: e} }
+	tests := []struct {
+		statement     ast.Statement
+		expectedError string
+	}{
+		{statement(unknownExpression{x}), "ast: can not encode node of type ast_test.unknownExpression"},
+		{&ast.LetStatement{Value: x}, "ast: LetStatement.Name is nil"},
+		{&ast.LetStatement{Name: x}, "ast: LetStatement.Value is nil"},
+		{&ast.ReturnStatement{}, "ast: ReturnStatement.ReturnValue is nil"},
+		{&ast.ExpressionStatement{}, "ast: ExpressionStatement.Expression is nil"},
+		{statement(&ast.PrefixExpression{Operator: "-"}), "ast: PrefixExpression.Right is nil"},
+		{statement(&ast.InfixExpression{Operator: "+", Right: x}), "ast: InfixExpression.Left is nil"},
+		{statement(&ast.InfixExpression{Left: x, Operator: "+"}), "ast: InfixExpression.Right is nil"},
+		{statement(&ast.IfExpression{Consequence: block}), "ast: IfExpression.Condition is nil"},
+		{statement(&ast.IfExpression{Condition: x}), "ast: IfExpression.Consequence is nil"},
+		{statement(&ast.FunctionLiteral{}), "ast: FunctionLiteral.Body is nil"},
+		{statement(&ast.FunctionLiteral{Parameters: []*ast.Identifier{x, nil}, Body: block}), "ast: FunctionLiteral.Parameters[1] is nil"},
+		{statement(&ast.CallExpression{}), "ast: CallExpression.Function is nil"},
+		{statement(&ast.CallExpression{Function: x, Arguments: []ast.Expression{nil}}), "ast: CallExpression.Arguments[0] is nil"},
+		{&ast.BlockStatement{Statements: []ast.Statement{nil}}, "ast: BlockStatement.Statements[0] is nil"},
+		{nil, "ast: Program.Statements[0] is nil"},
+		// a typed nil is encoded like a nil
+		{&ast.LetStatement{Name: (*ast.Identifier)(nil), Value: x}, "ast: LetStatement.Name is nil"},
+	}
+	for _, tt := range tests {
+		program := &ast.Program{Statements: []ast.Statement{tt.statement}}
+		data, err := program.MarshalBinary()
+		if err == nil {
+			err = (&ast.Program{}).UnmarshalBinary(data)
+		}
+		if err == nil {
+			t.Errorf("\n no error for %#v", tt.statement)
+			continue
+		}
+		if err.Error() != tt.expectedError {
+			t.Errorf("\n wrong error for %#v. \ngot %q \nwanted %q", tt.statement, err, tt.expectedError)
+		}
+	}
+
+	// the field that can be nil decodes fine.
+	program := &ast.Program{Statements: []ast.Statement{
+		statement(&ast.IfExpression{Condition: x, Consequence: block}),
+	}}
+	data, err := program.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (&ast.Program{}).UnmarshalBinary(data); err != nil {
+		t.Errorf("\n could not decode %q: %v", program.String(), err)
+	}
+}
+
+// deepProgram returns a program that is depth nodes deep; a statement of !!!...true
+func deepProgram(depth int) *ast.Program {
+	var x ast.Expression = &ast.Boolean{Token: token.Token{Type: token.TRUE, Value: "true"}, Value: true}
+	for i := 2; i < depth; i++ {
+		x = &ast.PrefixExpression{Token: token.NewToken(token.BANG, '!'), Operator: "!", Right: x}
+	}
+	return &ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{Token: token.NewToken(token.BANG, '!'), Expression: x}}}
+}
+
+func TestBinaryMaxDepth(t *testing.T) {
+	expectedError := "ast: program is nested more than 4000 nodes deep"
+
+	program := deepProgram(ast.MaxDepth)
+	data, err := program.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &ast.Program{}
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !ast.Equal(decoded, program) {
+		t.Errorf("\n round trip changed the program")
+	}
+
+	if _, err := deepProgram(ast.MaxDepth + 1).MarshalBinary(); err == nil || err.Error() != expectedError {
+		t.Errorf("\n wrong error. \ngot %v \nwanted %q", err, expectedError)
+	}
+
+	// the encoder will not make data that is too deep, so it is made from the encodings of two programs; they differ in one ! node.
+	short, _ := deepProgram(10).MarshalBinary()
+	long, _ := deepProgram(11).MarshalBinary()
+	i := 0
+	for short[i] == long[i] {
+		i++
+	}
+	bang := long[i : i+len(long)-len(short)]
+	for _, tt := range []struct {
+		bangs         int
+		expectedError string
+	}{
+		{ast.MaxDepth - 11, ""},
+		{ast.MaxDepth - 10, expectedError},
+	} {
+		data := append(append(append([]byte{}, long[:i]...), bytes.Repeat(bang, tt.bangs)...), long[i:]...)
+		err := (&ast.Program{}).UnmarshalBinary(data)
+		if (err == nil && tt.expectedError != "") || (err != nil && err.Error() != tt.expectedError) {
+			t.Errorf("\n wrong error for a program %d nodes deep. \ngot %v \nwanted %q", 11+tt.bangs, err, tt.expectedError)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package ast
+
+import "reflect"
+
+/*
+Equal reports whether a and b are the same AST; ie they have the same kinds of nodes, with the same values,
+in the same places. Tokens, and so positions, are ignored; only what the code means is compared.
+eg the ASTs of;
+
+	let x = 0x2A;
+	let   x=42 ;
+
+are Equal, even though the tokens of their literals differ. So are the AST of a program and the AST of its String.
+A nil node is only Equal to another nil node.
+*/
+func Equal(a, b Node) bool {
+	if isNil(a) || isNil(b) {
+		return isNil(a) && isNil(b)
+	}
+
+	switch x := a.(type) {
+	case *Program:
+		y, ok := b.(*Program)
+		return ok && equalStatements(x.Statements, y.Statements)
+	case *LetStatement:
+		y, ok := b.(*LetStatement)
+		return ok && Equal(x.Name, y.Name) && Equal(x.Value, y.Value)
+	case *ReturnStatement:
+		y, ok := b.(*ReturnStatement)
+		return ok && Equal(x.ReturnValue, y.ReturnValue)
+	case *ExpressionStatement:
+		y, ok := b.(*ExpressionStatement)
+		return ok && Equal(x.Expression, y.Expression)
+	case *BlockStatement:
+		y, ok := b.(*BlockStatement)
+		return ok && equalStatements(x.Statements, y.Statements)
+	case *Identifier:
+		y, ok := b.(*Identifier)
+		return ok && x.Value == y.Value
+	case *IntegerLiteral:
+		y, ok := b.(*IntegerLiteral)
+		if !ok {
+			return false
+		}
+		if x.Big != nil || y.Big != nil {
+			return x.Big != nil && y.Big != nil && x.Big.Cmp(y.Big) == 0
+		}
+		return x.Value == y.Value
+	case *FloatLiteral:
+		y, ok := b.(*FloatLiteral)
+		return ok && x.Value == y.Value
+	case *StringLiteral:
+		y, ok := b.(*StringLiteral)
+		return ok && x.Value == y.Value
+	case *Boolean:
+		y, ok := b.(*Boolean)
+		return ok && x.Value == y.Value
+	case *PrefixExpression:
+		y, ok := b.(*PrefixExpression)
+		return ok && x.Operator == y.Operator && Equal(x.Right, y.Right)
+	case *InfixExpression:
+		y, ok := b.(*InfixExpression)
+		return ok && x.Operator == y.Operator && Equal(x.Left, y.Left) && Equal(x.Right, y.Right)
+	case *IfExpression:
+		y, ok := b.(*IfExpression)
+		return ok && Equal(x.Condition, y.Condition) && Equal(x.Consequence, y.Consequence) && Equal(x.Alternative, y.Alternative)
+	case *FunctionLiteral:
+		y, ok := b.(*FunctionLiteral)
+		if !ok || len(x.Parameters) != len(y.Parameters) {
+			return false
+		}
+		for i := range x.Parameters {
+			if !Equal(x.Parameters[i], y.Parameters[i]) {
+				return false
+			}
+		}
+		return Equal(x.Body, y.Body)
+	case *CallExpression:
+		y, ok := b.(*CallExpression)
+		if !ok || len(x.Arguments) != len(y.Arguments) || !Equal(x.Function, y.Function) {
+			return false
+		}
+		for i := range x.Arguments {
+			if !Equal(x.Arguments[i], y.Arguments[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func equalStatements(a, b []Statement) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isNil reports whether n is nil, or a nil pointer like the Alternative of an if without an else.
+func isNil(n Node) bool {
+	if n == nil {
+		return true
+	}
+	v := reflect.ValueOf(n)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
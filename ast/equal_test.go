@@ -0,0 +1,62 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/komuw/cali/ast"
+)
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"", "", true},
+		{"let x = 5;", "let   x=5 ;", true},
+		{"let x = 0x2A;", "let x = 42;", true},
+		{"let x = 99999999999999999999;", "let x = 99_999_999_999_999_999_999;", true},
+		{"1.5e3;", "1500.0;", true},
+		{`"a\tb";`, `"a	b";`, true},
+		{"(1 + 2) * 3;", "((1 + 2) * 3);", true},
+		{"if (x) { 1; }", "if (x) { 1; };", true},
+		{"fn(a, b) { a + b; }(1, 2);", "fn(a, b) { (a + b); }(1, 2);", true},
+		// the same positions don't make it the same code.
+		{"let x = 5;", "let y = 5;", false},
+		{"let x = 5;", "let x = 6;", false},
+		{"let x = 5;", "return 5;", false},
+		{"let x = 99999999999999999999;", "let x = 99999999999999999998;", false},
+		{"5;", "5.0;", false},
+		{"1 + 2 * 3;", "(1 + 2) * 3;", false},
+		{"1 + 2;", "1 - 2;", false},
+		{"-x;", "!x;", false},
+		{"if (x) { 1; }", "if (x) { 1; } else { 1; }", false},
+		{"if (x) { 1; }", "if (x) { 1; 2; }", false},
+		{"fn(a) { a; };", "fn(b) { b; };", false},
+		{"fn(a) { a; };", "fn(a, b) { a; };", false},
+		{"add(1, 2);", "add(1);", false},
+		{"add(1, 2);", "sub(1, 2);", false},
+		{"true;", "false;", false},
+		{`"a";`, `"b";`, false},
+		{"5;", "5; 5;", false},
+	}
+	for _, tt := range tests {
+		a, b := parse(t, "a.cali", tt.a), parse(t, "b.cali", tt.b)
+		if got := ast.Equal(a, b); got != tt.expected {
+			t.Errorf("\n wrong result for %q and %q. \ngot %v \nwanted %v", tt.a, tt.b, got, tt.expected)
+		}
+		if got := ast.Equal(b, a); got != tt.expected {
+			t.Errorf("\n Equal is not symmetric for %q and %q", tt.a, tt.b)
+		}
+	}
+}
+
+func TestEqualNil(t *testing.T) {
+	var block *ast.BlockStatement
+	program := parse(t, "", "5;")
+	if !ast.Equal(nil, nil) || !ast.Equal(nil, block) || !ast.Equal(block, nil) {
+		t.Errorf("\n nil nodes are not Equal")
+	}
+	if ast.Equal(program, nil) || ast.Equal(nil, program) || ast.Equal(program, block) {
+		t.Errorf("\n a nil node is Equal to a program")
+	}
+}
@@ -0,0 +1,663 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"strconv"
+
+	"github.com/komuw/cali/token"
+)
+
+/*
+JSON ENCODING
+
+MarshalJSON and UnmarshalJSON turn a *Program into JSON and back, so that tools written in other languages(eg linters)
+can work with cali syntax trees. The schema is stable; fields may be added, but existing ones are not changed or removed
+without bumping jsonVersion.
+
+The program is an object;
+
+	{"kind": "Program", "version": 1, "statements": [...]}
+
+and every node is an object with the fields;
+
+	kind   the name of the node's type; eg "LetStatement" or "InfixExpression"
+	token  the node's token; {"type": "LET", "value": "let", "pos": position, "end": position}
+	span   {"start": position, "end": position}; where the node starts and ends in the source code.
+	       That is from the first to the end of the last token of the node; including the closing } of a block and
+	       the ) of a call. Parentheses around an expression(like the ones in; (1 + 2) * 3) are not part of the AST,
+	       so they are not part of its span.
+
+plus the fields of the node's type, named like the Go fields but in camelCase;
+
+	LetStatement         name(Identifier), value(expression)
+	ReturnStatement      returnValue(expression)
+	ExpressionStatement  expression(expression)
+	BlockStatement       statements([]statement), rbrace(token)
+	Identifier           value(string)
+	IntegerLiteral       value(string); a string since integers can be bigger than what JSON numbers can hold exactly.
+	FloatLiteral         value(number)
+	StringLiteral        value(string)
+	Boolean              value(bool)
+	PrefixExpression     operator(string), right(expression)
+	InfixExpression      left(expression), operator(string), right(expression)
+	IfExpression         condition(expression), consequence(BlockStatement), alternative(BlockStatement or null)
+	FunctionLiteral      parameters([]Identifier), body(BlockStatement)
+	CallExpression       function(expression), arguments([]expression), rparen(token)
+
+A position is {"filename": "main.cali", "offset": 0, "line": 1, "column": 1}; filename is left out if there is none.
+
+The JSON nests as deep as the AST. Like the binary encoding, programs nested more than MaxDepth nodes deep(eg a sum
+of thousands of numbers) can not be encoded or decoded. The JSON of the others is less deep than the 10000 levels
+that encoding/json can handle, so they can also be encoded and decoded with json.Marshal and json.Unmarshal.
+*/
+
+// jsonVersion is the version of the JSON schema.
+const jsonVersion = 1
+
+/*
+MarshalJSON encodes the program; see JSON ENCODING. It implements json.Marshaler
+It goes over the AST once; the span of a node is worked out from the spans of its children as they are written.
+*/
+func (p *Program) MarshalJSON() ([]byte, error) {
+	e := &jsonEncoder{}
+	e.buf.WriteString(`{"kind":"Program","version":`)
+	e.value(jsonVersion)
+	e.buf.WriteString(`,"statements":`)
+	e.statements(p.Statements)
+	e.buf.WriteByte('}')
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.buf.Bytes(), nil
+}
+
+/*
+UnmarshalJSON decodes data, as produced by MarshalJSON, into p. It implements json.Unmarshaler
+Like UnmarshalBinary, it returns an error for a program with nil nodes where the parser always puts one.
+*/
+func (p *Program) UnmarshalJSON(data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			de, ok := r.(decodeError)
+			if !ok {
+				panic(r)
+			}
+			err = de.err
+		}
+	}()
+
+	d := &jsonDecoder{dec: json.NewDecoder(bytes.NewReader(data))}
+	var (
+		kind       string
+		version    int
+		statements []Node
+		fields     = map[string]bool{}
+	)
+	d.object(func(name string) {
+		fields[name] = true
+		switch name {
+		case "kind":
+			kind = d.string(name)
+		case "version":
+			d.field(name, &version)
+		case "statements":
+			statements = d.nodes(name)
+		default:
+			d.skip(name)
+		}
+	})
+	if _, err := d.dec.Token(); err != io.EOF {
+		if err == nil {
+			jsonFail("unexpected data after the program")
+		}
+		jsonFail("%v", err)
+	}
+	if !fields["kind"] {
+		return fmt.Errorf("ast: field %q is missing", "kind")
+	}
+	if kind != "Program" {
+		return fmt.Errorf("ast: JSON is a %q, not a Program", kind)
+	}
+	if !fields["version"] {
+		return fmt.Errorf("ast: field %q is missing", "version")
+	}
+	if version != jsonVersion {
+		return fmt.Errorf("ast: unsupported JSON version %d, want %d", version, jsonVersion)
+	}
+	p.Statements = jsonStatements(statements, "Program.Statements")
+	return nil
+}
+
+// jsonSpan is the "span" field of a node.
+type jsonSpan struct {
+	Start token.Position `json:"start"`
+	End   token.Position `json:"end"`
+}
+
+/*
+jsonEncoder writes the JSON of an AST. Nodes are written by hand, instead of being turned into maps for encoding/json;
+which would take a walk over the children of every node to find its span, and then another one to encode it.
+Only the values in the nodes, like tokens and strings, are encoded with encoding/json.
+The first error stops nothing, but is what MarshalJSON returns.
+*/
+type jsonEncoder struct {
+	buf   bytes.Buffer
+	err   error
+	depth int // how many nodes the node being written is in
+}
+
+// value writes v encoded by encoding/json.
+func (e *jsonEncoder) value(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		if e.err == nil {
+			e.err = err
+		}
+		data = []byte("null")
+	}
+	e.buf.Write(data)
+}
+
+// field writes the name of the next field of an object; all objects start with the kind, so there is one before it.
+func (e *jsonEncoder) field(name string) {
+	e.buf.WriteString(`,"`)
+	e.buf.WriteString(name)
+	e.buf.WriteString(`":`)
+}
+
+func (e *jsonEncoder) statements(stmts []Statement) (span jsonSpan) {
+	e.buf.WriteByte('[')
+	for i, s := range stmts {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		span = span.extend(e.node(s))
+	}
+	e.buf.WriteByte(']')
+	return span
+}
+
+func (e *jsonEncoder) expressions(exps []Expression) (span jsonSpan) {
+	e.buf.WriteByte('[')
+	for i, x := range exps {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		span = span.extend(e.node(x))
+	}
+	e.buf.WriteByte(']')
+	return span
+}
+
+/*
+node writes the JSON of n, and returns its span. A nil n is written as null and has an empty span.
+The fields of n can be nil even where the parser never leaves them nil; eg for an AST that a tool made up.
+*/
+func (e *jsonEncoder) node(n Node) jsonSpan {
+	if isNil(n) {
+		e.buf.WriteString("null")
+		return jsonSpan{}
+	}
+	if e.depth == MaxDepth {
+		if e.err == nil {
+			e.err = errTooDeep
+		}
+		e.buf.WriteString("null")
+		return jsonSpan{}
+	}
+	e.depth++
+	defer func() { e.depth-- }()
+
+	tok := nodeToken(n)
+	span := jsonSpan{Start: tok.Pos, End: tok.End}
+
+	e.buf.WriteString(`{"kind":`)
+	e.value(reflect.TypeOf(n).Elem().Name())
+	e.field("token")
+	e.value(tok)
+	switch n := n.(type) {
+	case *LetStatement:
+		e.field("name")
+		span = span.extend(e.node(n.Name))
+		e.field("value")
+		span = span.extend(e.node(n.Value))
+	case *ReturnStatement:
+		e.field("returnValue")
+		span = span.extend(e.node(n.ReturnValue))
+	case *ExpressionStatement:
+		e.field("expression")
+		span = span.extend(e.node(n.Expression))
+	case *BlockStatement:
+		e.field("statements")
+		span = span.extend(e.statements(n.Statements))
+		e.field("rbrace")
+		e.value(n.Rbrace)
+		span = span.extend(jsonSpan{Start: n.Rbrace.Pos, End: n.Rbrace.End})
+	case *Identifier:
+		e.field("value")
+		e.value(n.Value)
+	case *IntegerLiteral:
+		e.field("value")
+		if n.Big != nil {
+			e.value(n.Big.String())
+		} else {
+			e.value(strconv.FormatInt(n.Value, 10))
+		}
+	case *FloatLiteral:
+		e.field("value")
+		e.value(n.Value)
+	case *StringLiteral:
+		e.field("value")
+		e.value(n.Value)
+	case *Boolean:
+		e.field("value")
+		e.value(n.Value)
+	case *PrefixExpression:
+		e.field("operator")
+		e.value(n.Operator)
+		e.field("right")
+		span = span.extend(e.node(n.Right))
+	case *InfixExpression:
+		e.field("left")
+		span = span.extend(e.node(n.Left))
+		e.field("operator")
+		e.value(n.Operator)
+		e.field("right")
+		span = span.extend(e.node(n.Right))
+	case *IfExpression:
+		e.field("condition")
+		span = span.extend(e.node(n.Condition))
+		e.field("consequence")
+		span = span.extend(e.node(n.Consequence))
+		e.field("alternative")
+		span = span.extend(e.node(n.Alternative))
+	case *FunctionLiteral:
+		e.field("parameters")
+		e.buf.WriteByte('[')
+		for i, param := range n.Parameters {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			span = span.extend(e.node(param))
+		}
+		e.buf.WriteByte(']')
+		e.field("body")
+		span = span.extend(e.node(n.Body))
+	case *CallExpression:
+		e.field("function")
+		span = span.extend(e.node(n.Function))
+		e.field("arguments")
+		span = span.extend(e.expressions(n.Arguments))
+		e.field("rparen")
+		e.value(n.Rparen)
+		span = span.extend(jsonSpan{Start: n.Rparen.Pos, End: n.Rparen.End})
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("ast: can not encode node of type %T", n)
+		}
+	}
+	// the span goes last, since it is only known once the children have been written.
+	e.field("span")
+	e.value(span)
+	e.buf.WriteByte('}')
+	return span
+}
+
+/*
+extend returns the span that covers both s and other. Positions that are not valid(eg of a node that was not made by
+the parser, or of an empty list) are left out.
+*/
+func (s jsonSpan) extend(other jsonSpan) jsonSpan {
+	if other.Start.IsValid() && (!s.Start.IsValid() || other.Start.Offset < s.Start.Offset) {
+		s.Start = other.Start
+	}
+	if other.End.IsValid() && (!s.End.IsValid() || other.End.Offset > s.End.Offset) {
+		s.End = other.End
+	}
+	return s
+}
+
+// jsonFail makes UnmarshalJSON return an error; see decodeError
+func jsonFail(format string, a ...interface{}) {
+	panic(decodeError{fmt.Errorf("ast: "+format, a...)})
+}
+
+/*
+jsonDecoder reads the JSON of a program, a token at a time, with a json.Decoder. Decoding the nodes into maps or
+json.RawMessages instead would decode the JSON of a node once for every node it is in.
+Like the binary decoder, it recurses as deep as the AST; so it stops at MaxDepth.
+*/
+type jsonDecoder struct {
+	dec   *json.Decoder
+	depth int // how many nodes the node being decoded is in
+}
+
+func (d *jsonDecoder) token() json.Token {
+	tok, err := d.dec.Token()
+	if err == io.EOF {
+		jsonFail("unexpected end of JSON input")
+	}
+	if err != nil {
+		jsonFail("%v", err)
+	}
+	return tok
+}
+
+func (d *jsonDecoder) string(name string) string {
+	s, ok := d.token().(string)
+	if !ok {
+		jsonFail("field %q is not a string", name)
+	}
+	return s
+}
+
+// field decodes the value of the field name into v.
+func (d *jsonDecoder) field(name string, v interface{}) {
+	if err := d.dec.Decode(v); err != nil {
+		jsonFail("field %q: %v", name, err)
+	}
+}
+
+// skip reads the value of the field name, whatever it is.
+func (d *jsonDecoder) skip(name string) {
+	var v json.RawMessage
+	d.field(name, &v)
+}
+
+/*
+object reads an object, and calls f with the name of each of its fields. f has to read the value of the field.
+A null is read as an object without fields.
+*/
+func (d *jsonDecoder) object(f func(name string)) {
+	switch tok := d.token(); tok {
+	case nil:
+		return
+	case json.Delim('{'):
+		d.fields(f)
+	default:
+		jsonFail("expected an object, not %v", tok)
+	}
+}
+
+// fields reads the rest of an object whose { has been read; see object
+func (d *jsonDecoder) fields(f func(name string)) {
+	for d.dec.More() {
+		f(d.token().(string)) // json.Decoder only returns strings for the names of fields
+	}
+	d.token()
+}
+
+// nodes reads an array of nodes. A null is read as an empty array.
+func (d *jsonDecoder) nodes(name string) []Node {
+	nodes := []Node{}
+	switch tok := d.token(); tok {
+	case nil:
+		return nodes
+	case json.Delim('['):
+	default:
+		jsonFail("field %q is not an array", name)
+	}
+	for d.dec.More() {
+		nodes = append(nodes, d.node())
+	}
+	d.token()
+	return nodes
+}
+
+// jsonChildFields are the fields of nodes that hold a node; see JSON ENCODING. value is one only for a LetStatement.
+var jsonChildFields = map[string]bool{
+	"name":        true,
+	"returnValue": true,
+	"expression":  true,
+	"right":       true,
+	"left":        true,
+	"condition":   true,
+	"consequence": true,
+	"alternative": true,
+	"body":        true,
+	"function":    true,
+}
+
+// jsonListFields are the fields of nodes that hold a list of nodes.
+var jsonListFields = map[string]bool{
+	"statements": true,
+	"parameters": true,
+	"arguments":  true,
+}
+
+/*
+node reads a node encoded by jsonEncoder.node; null is read as a nil Node.
+The fields can come in any order, so they are all read before the node is made. The span is not decoded; it is
+computed from the tokens.
+*/
+func (d *jsonDecoder) node() Node {
+	switch tok := d.token(); tok {
+	case nil:
+		return nil
+	case json.Delim('{'):
+		return d.nodeFields()
+	default:
+		jsonFail("expected a node, not %v", tok)
+		return nil
+	}
+}
+
+// nodeFields reads the rest of a node whose { has been read; see node
+func (d *jsonDecoder) nodeFields() Node {
+	if d.depth == MaxDepth {
+		panic(decodeError{errTooDeep})
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+
+	var (
+		fields         = map[string]bool{} // the fields that are there
+		kind, operator string
+		tok            token.Token
+		value          json.Token // the value of a node that is not a LetStatement
+		children       = map[string]Node{}
+		lists          = map[string][]Node{}
+		rbrace, rparen token.Token
+	)
+	d.fields(func(name string) {
+		fields[name] = true
+		switch {
+		case name == "kind":
+			kind = d.string(name)
+		case name == "operator":
+			operator = d.string(name)
+		case name == "token":
+			d.field(name, &tok)
+		case name == "rbrace":
+			d.field(name, &rbrace)
+		case name == "rparen":
+			d.field(name, &rparen)
+		case name == "value":
+			// the value of a LetStatement is a node, the others are strings, numbers or bools.
+			switch value = d.token(); value {
+			case json.Delim('{'):
+				children[name] = d.nodeFields()
+			case json.Delim('['):
+				jsonFail("field %q is an array", name)
+			}
+		case jsonChildFields[name]:
+			children[name] = d.node()
+		case jsonListFields[name]:
+			lists[name] = d.nodes(name)
+		default:
+			// the span, and fields added to the schema later.
+			d.skip(name)
+		}
+	})
+	// required makes sure that the fields that all the nodes of a kind have are there.
+	required := func(names ...string) {
+		for _, name := range names {
+			if !fields[name] {
+				jsonFail("field %q is missing", name)
+			}
+		}
+	}
+	// valueOf returns the value of the node, which has to be of the same type as zero.
+	valueOf := func(zero interface{}) interface{} {
+		required("value")
+		if _, ok := value.(json.Delim); ok {
+			jsonFail("field %q is an object", "value")
+		}
+		if reflect.TypeOf(value) != reflect.TypeOf(zero) {
+			jsonFail("field %q is %v, not a %T", "value", value, zero)
+		}
+		return value
+	}
+	required("kind", "token")
+
+	switch kind {
+	case "LetStatement":
+		return &LetStatement{
+			Token: tok,
+			Name:  jsonRequiredIdentifier(children["name"], "LetStatement.Name"),
+			Value: jsonRequiredExpression(children["value"], "LetStatement.Value"),
+		}
+	case "ReturnStatement":
+		return &ReturnStatement{Token: tok, ReturnValue: jsonRequiredExpression(children["returnValue"], "ReturnStatement.ReturnValue")}
+	case "ExpressionStatement":
+		return &ExpressionStatement{Token: tok, Expression: jsonRequiredExpression(children["expression"], "ExpressionStatement.Expression")}
+	case "BlockStatement":
+		return &BlockStatement{Token: tok, Statements: jsonStatements(lists["statements"], "BlockStatement.Statements"), Rbrace: rbrace}
+	case "Identifier":
+		return &Identifier{Token: tok, Value: valueOf("").(string)}
+	case "IntegerLiteral":
+		il := &IntegerLiteral{Token: tok}
+		value := valueOf("").(string)
+		if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+			il.Value = v
+		} else if b, ok := new(big.Int).SetString(value, 10); ok {
+			il.Big = b
+		} else {
+			jsonFail("invalid integer %q", value)
+		}
+		return il
+	case "FloatLiteral":
+		return &FloatLiteral{Token: tok, Value: valueOf(0.0).(float64)}
+	case "StringLiteral":
+		return &StringLiteral{Token: tok, Value: valueOf("").(string)}
+	case "Boolean":
+		return &Boolean{Token: tok, Value: valueOf(false).(bool)}
+	case "PrefixExpression":
+		required("operator")
+		return &PrefixExpression{Token: tok, Operator: operator, Right: jsonRequiredExpression(children["right"], "PrefixExpression.Right")}
+	case "InfixExpression":
+		required("operator")
+		return &InfixExpression{
+			Token:    tok,
+			Left:     jsonRequiredExpression(children["left"], "InfixExpression.Left"),
+			Operator: operator,
+			Right:    jsonRequiredExpression(children["right"], "InfixExpression.Right"),
+		}
+	case "IfExpression":
+		return &IfExpression{
+			Token:       tok,
+			Condition:   jsonRequiredExpression(children["condition"], "IfExpression.Condition"),
+			Consequence: jsonRequiredBlock(children["consequence"], "IfExpression.Consequence"),
+			Alternative: jsonBlock(children["alternative"]),
+		}
+	case "FunctionLiteral":
+		fl := &FunctionLiteral{Token: tok, Parameters: []*Identifier{}}
+		for i, param := range lists["parameters"] {
+			fl.Parameters = append(fl.Parameters, jsonRequiredIdentifier(param, fmt.Sprintf("FunctionLiteral.Parameters[%d]", i)))
+		}
+		fl.Body = jsonRequiredBlock(children["body"], "FunctionLiteral.Body")
+		return fl
+	case "CallExpression":
+		call := &CallExpression{Token: tok, Function: jsonRequiredExpression(children["function"], "CallExpression.Function"), Arguments: []Expression{}, Rparen: rparen}
+		for i, arg := range lists["arguments"] {
+			call.Arguments = append(call.Arguments, jsonRequiredExpression(arg, fmt.Sprintf("CallExpression.Arguments[%d]", i)))
+		}
+		return call
+	default:
+		jsonFail("unknown node kind %q", kind)
+		return nil
+	}
+}
+
+// jsonStatements checks that nodes are all statements; field is the name of the list, for errors.
+func jsonStatements(nodes []Node, field string) []Statement {
+	stmts := make([]Statement, 0, len(nodes))
+	for i, n := range nodes {
+		if n == nil {
+			jsonFail("%s[%d] is nil", field, i)
+		}
+		s, ok := n.(Statement)
+		if !ok {
+			jsonFail("%T is not a statement", n)
+		}
+		stmts = append(stmts, s)
+	}
+	return stmts
+}
+
+func jsonExpression(n Node) Expression {
+	if n == nil {
+		return nil
+	}
+	x, ok := n.(Expression)
+	if !ok {
+		jsonFail("%T is not an expression", n)
+	}
+	return x
+}
+
+func jsonBlock(n Node) *BlockStatement {
+	if n == nil {
+		return nil
+	}
+	b, ok := n.(*BlockStatement)
+	if !ok {
+		jsonFail("%T is not a block statement", n)
+	}
+	return b
+}
+
+func jsonIdentifier(n Node) *Identifier {
+	if n == nil {
+		return nil
+	}
+	i, ok := n.(*Identifier)
+	if !ok {
+		jsonFail("%T is not an identifier", n)
+	}
+	return i
+}
+
+/*
+The jsonRequired funcs check the fields that the parser never leaves nil, like the binary decoder does;
+see Program.UnmarshalBinary. field is the name of the field, for errors.
+*/
+
+func jsonRequiredExpression(n Node, field string) Expression {
+	x := jsonExpression(n)
+	if x == nil {
+		jsonFail("%s is nil", field)
+	}
+	return x
+}
+
+func jsonRequiredBlock(n Node, field string) *BlockStatement {
+	b := jsonBlock(n)
+	if b == nil {
+		jsonFail("%s is nil", field)
+	}
+	return b
+}
+
+func jsonRequiredIdentifier(n Node, field string) *Identifier {
+	i := jsonIdentifier(n)
+	if i == nil {
+		jsonFail("%s is nil", field)
+	}
+	return i
+}
@@ -0,0 +1,268 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/komuw/cali/ast"
+	"github.com/komuw/cali/token"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	tests := []*ast.Program{
+		parse(t, "main.cali", binaryTestInput),
+		parse(t, "", "5;"),
+		parse(t, "", ""),
+	}
+	for _, program := range tests {
+		data, err := json.Marshal(program)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := &ast.Program{}
+		if err := json.Unmarshal(data, decoded); err != nil {
+			t.Fatalf("\n could not decode %q: %v", program.String(), err)
+		}
+		if !reflect.DeepEqual(decoded, program) {
+			t.Errorf("\n round trip changed the program. \ngot %q \nwanted %q", decoded.String(), program.String())
+		}
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	data, err := json.Marshal(parse(t, "main.cali", "let x = add(1, 2);"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// decode into plain maps, like a tool written in another language would.
+	var program map[string]interface{}
+	if err := json.Unmarshal(data, &program); err != nil {
+		t.Fatal(err)
+	}
+	if program["kind"] != "Program" || program["version"] != 1.0 {
+		t.Fatalf("\n wrong program header: %v", program)
+	}
+	let := program["statements"].([]interface{})[0].(map[string]interface{})
+	if let["kind"] != "LetStatement" {
+		t.Errorf("\n wrong kind. \ngot %v \nwanted %v", let["kind"], "LetStatement")
+	}
+	tok := let["token"].(map[string]interface{})
+	if tok["type"] != "LET" || tok["value"] != "let" {
+		t.Errorf("\n wrong token. \ngot %v", tok)
+	}
+	span := let["span"].(map[string]interface{})
+	start, end := span["start"].(map[string]interface{}), span["end"].(map[string]interface{})
+	if start["filename"] != "main.cali" || start["offset"] != 0.0 || start["line"] != 1.0 || start["column"] != 1.0 {
+		t.Errorf("\n wrong span start. \ngot %v", start)
+	}
+	// the end of the ) of the call. The ; is not part of the statement.
+	if end["offset"] != 17.0 || end["column"] != 18.0 {
+		t.Errorf("\n wrong span end. \ngot %v", end)
+	}
+	name := let["name"].(map[string]interface{})
+	if name["kind"] != "Identifier" || name["value"] != "x" {
+		t.Errorf("\n wrong name. \ngot %v", name)
+	}
+	call := let["value"].(map[string]interface{})
+	if call["kind"] != "CallExpression" || len(call["arguments"].([]interface{})) != 2 {
+		t.Errorf("\n wrong value. \ngot %v", call)
+	}
+	arg := call["arguments"].([]interface{})[0].(map[string]interface{})
+	if arg["kind"] != "IntegerLiteral" || arg["value"] != "1" {
+		t.Errorf("\n wrong argument. \ngot %v", arg)
+	}
+}
+
+// a tool can write the fields in any order, and add ones that cali does not know.
+func TestJSONFieldOrder(t *testing.T) {
+	data := `{"statements": [{"span": {"start": {}, "end": {}}, "later": [[{}]],
+		"expression": {"value": "1", "token": {"type": "INT", "value": "1"}, "kind": "IntegerLiteral"},
+		"token": {"type": "INT", "value": "1"}, "kind": "ExpressionStatement"}], "version": 1, "kind": "Program"}`
+	program := &ast.Program{}
+	if err := program.UnmarshalJSON([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := program.String(), "1;"; got != expected {
+		t.Errorf("\n wrong program. \ngot %q \nwanted %q", got, expected)
+	}
+}
+
+// the span of a node covers all of it; from its first to its last token, wherever those are in its AST.
+func TestJSONSpans(t *testing.T) {
+	input := "fn(x) {\n  x;\n}(add(1, 2) + 3);\nif (x) { 1; } else { 2; };"
+	data, err := parse(t, "", input).MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var program struct{ Statements []jsonNode }
+	if err := json.Unmarshal(data, &program); err != nil {
+		t.Fatal(err)
+	}
+	call := program.Statements[0].Expression
+	fn := call.Function
+	ifExp := program.Statements[1].Expression
+	tests := []struct {
+		node     *jsonNode
+		expected string
+	}{
+		{&program.Statements[0], "fn(x) {\n  x;\n}(add(1, 2) + 3)"},
+		{call, "fn(x) {\n  x;\n}(add(1, 2) + 3)"},
+		{fn, "fn(x) {\n  x;\n}"},
+		{fn.Body, "{\n  x;\n}"},
+		{call.Arguments[0], "add(1, 2) + 3"},
+		{call.Arguments[0].Left, "add(1, 2)"},
+		{ifExp, "if (x) { 1; } else { 2; }"},
+		{ifExp.Consequence, "{ 1; }"},
+	}
+	for _, tt := range tests {
+		if got := input[tt.node.Span.Start.Offset:tt.node.Span.End.Offset]; got != tt.expected {
+			t.Errorf("\n wrong span for the %s. \ngot %q \nwanted %q", tt.node.Kind, got, tt.expected)
+		}
+	}
+}
+
+// jsonNode has the fields of the JSON of a node that TestJSONSpans needs.
+type jsonNode struct {
+	Kind        string
+	Span        struct{ Start, End token.Position }
+	Expression  *jsonNode
+	Function    *jsonNode
+	Arguments   []*jsonNode
+	Left        *jsonNode
+	Body        *jsonNode
+	Consequence *jsonNode
+}
+
+func TestJSONMaxDepth(t *testing.T) {
+	expectedError := "ast: program is nested more than 4000 nodes deep"
+
+	// the JSON of a program that deep can be decoded with encoding/json too.
+	program := deepProgram(ast.MaxDepth)
+	data, err := json.Marshal(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &ast.Program{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !ast.Equal(decoded, program) {
+		t.Errorf("\n round trip changed the program")
+	}
+
+	if _, err := deepProgram(ast.MaxDepth + 1).MarshalJSON(); err == nil || err.Error() != expectedError {
+		t.Errorf("\n wrong error. \ngot %v \nwanted %q", err, expectedError)
+	}
+
+	// the encoder will not make JSON that is too deep, so it is written here.
+	bang := `{"kind": "PrefixExpression", "token": {"type": "!", "value": "!"}, "operator": "!", "right": `
+	for _, tt := range []struct {
+		depth         int
+		expectedError string
+	}{
+		{ast.MaxDepth, ""},
+		{ast.MaxDepth + 1, expectedError},
+	} {
+		data := `{"kind": "Program", "version": 1, "statements": [{"kind": "ExpressionStatement", "token": {"type": "!", "value": "!"}, "expression": ` +
+			strings.Repeat(bang, tt.depth-2) + `{"kind": "Boolean", "token": {"type": "TRUE", "value": "true"}, "value": true}` +
+			strings.Repeat("}", tt.depth-1) + "]}"
+		decoded := &ast.Program{}
+		err := decoded.UnmarshalJSON([]byte(data))
+		if (err == nil && tt.expectedError != "") || (err != nil && err.Error() != tt.expectedError) {
+			t.Errorf("\n wrong error for a program %d nodes deep. \ngot %v \nwanted %q", tt.depth, err, tt.expectedError)
+		}
+		if err == nil && !ast.Equal(decoded, deepProgram(tt.depth)) {
+			t.Errorf("\n wrong program for a program %d nodes deep", tt.depth)
+		}
+	}
+}
+
+func TestJSONDecodeErrors(t *testing.T) {
+	tests := []struct {
+		data          string
+		expectedError string
+	}{
+		{`{"kind": "LetStatement"}`, `ast: JSON is a "LetStatement", not a Program`},
+		{`{"kind": "Program", "version": 2, "statements": []}`, "ast: unsupported JSON version 2, want 1"},
+		{`{"kind": "Program", "version": 1, "statements": [{"kind": "Nope", "token": {"type": "INT", "value": "1"}}]}`, `ast: unknown node kind "Nope"`},
+		{`{"kind": "Program", "version": 1, "statements": [{"kind": "Identifier", "token": {"type": "INT", "value": "1"}, "value": "x"}]}`, "ast: *ast.Identifier is not a statement"},
+		{`{"kind": "Program", "version": 1, "statements": [{"kind": "BlockStatement", "token": {"type": "WAT", "value": "1"}}]}`, `ast: field "token": token: unknown token type "WAT"`},
+		{`{"kind": "Program", "version": 1, "statements": [{"kind": "ExpressionStatement", "token": {"type": "INT", "value": "x"},
+			"expression": {"kind": "IntegerLiteral", "token": {"type": "INT", "value": "x"}, "value": "x"}}]}`, `ast: invalid integer "x"`},
+		{`{"kind": "Program", "version": 1, "statements": [}`, "ast: invalid character '}' looking for beginning of value"},
+		{`{"kind": "Program", "version": 1, "statements": [`, "ast: unexpected end of JSON input"},
+		{`{"kind": "Program", "version": 1, "statements": []} x`, "ast: invalid character 'x' looking for beginning of value"},
+		{`{"kind": "Program", "version": 1, "statements": [], "later": {"a": [1, {"b": tru}]}}`, `ast: field "later": invalid character '}' in literal true (expecting 'e')`},
+		{`{"version": 1, "statements": []}`, `ast: field "kind" is missing`},
+	}
+	for _, tt := range tests {
+		err := (&ast.Program{}).UnmarshalJSON([]byte(tt.data))
+		if err == nil {
+			t.Errorf("\n no error for %s", tt.data)
+			continue
+		}
+		if err.Error() != tt.expectedError {
+			t.Errorf("\n wrong error for %s. \ngot %q \nwanted %q", tt.data, err, tt.expectedError)
+		}
+	}
+}
+
+func TestJSONDecodeNilChildren(t *testing.T) {
+	x := &ast.Identifier{Value: "x"}
+	block := &ast.BlockStatement{}
+	statement := func(e ast.Expression) ast.Statement { return &ast.ExpressionStatement{Expression: e} }
+	tests := []struct {
+		statement     ast.Statement
+		expectedError string
+	}{
+		{&ast.LetStatement{Value: x}, "ast: LetStatement.Name is nil"},
+		{&ast.LetStatement{Name: x}, "ast: LetStatement.Value is nil"},
+		{&ast.ReturnStatement{}, "ast: ReturnStatement.ReturnValue is nil"},
+		{&ast.ExpressionStatement{}, "ast: ExpressionStatement.Expression is nil"},
+		{statement(&ast.PrefixExpression{Operator: "-"}), "ast: PrefixExpression.Right is nil"},
+		{statement(&ast.InfixExpression{Operator: "+", Right: x}), "ast: InfixExpression.Left is nil"},
+		{statement(&ast.InfixExpression{Left: x, Operator: "+"}), "ast: InfixExpression.Right is nil"},
+		{statement(&ast.IfExpression{Consequence: block}), "ast: IfExpression.Condition is nil"},
+		{statement(&ast.IfExpression{Condition: x}), "ast: IfExpression.Consequence is nil"},
+		{statement(&ast.FunctionLiteral{}), "ast: FunctionLiteral.Body is nil"},
+		{statement(&ast.FunctionLiteral{Parameters: []*ast.Identifier{x, nil}, Body: block}), "ast: FunctionLiteral.Parameters[1] is nil"},
+		{statement(&ast.CallExpression{}), "ast: CallExpression.Function is nil"},
+		{statement(&ast.CallExpression{Function: x, Arguments: []ast.Expression{nil}}), "ast: CallExpression.Arguments[0] is nil"},
+		{&ast.BlockStatement{Statements: []ast.Statement{nil}}, "ast: BlockStatement.Statements[0] is nil"},
+		{nil, "ast: Program.Statements[0] is nil"},
+	}
+	for _, tt := range tests {
+		program := &ast.Program{Statements: []ast.Statement{tt.statement}}
+		data, err := program.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = (&ast.Program{}).UnmarshalJSON(data)
+		if err == nil {
+			t.Errorf("\n no error for %s", data)
+			continue
+		}
+		if err.Error() != tt.expectedError {
+			t.Errorf("\n wrong error for %s. \ngot %q \nwanted %q", data, err, tt.expectedError)
+		}
+	}
+
+	// a field that is left out is like one that is null.
+	missing := `{"kind": "Program", "version": 1, "statements": [{"kind": "ExpressionStatement", "token": {"type": "INT", "value": "1"},
+		"expression": {"kind": "InfixExpression", "token": {"type": "+", "value": "+"}, "operator": "+"}}]}`
+	if err := (&ast.Program{}).UnmarshalJSON([]byte(missing)); err == nil || err.Error() != "ast: InfixExpression.Left is nil" {
+		t.Errorf("\n wrong error for %s. \ngot %v \nwanted %q", missing, err, "ast: InfixExpression.Left is nil")
+	}
+
+	// the field that can be nil decodes fine.
+	program := &ast.Program{Statements: []ast.Statement{statement(&ast.IfExpression{Condition: x, Consequence: block})}}
+	data, err := program.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (&ast.Program{}).UnmarshalJSON(data); err != nil {
+		t.Errorf("\n could not decode %q: %v", program.String(), err)
+	}
+}
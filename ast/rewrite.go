@@ -0,0 +1,276 @@
+package ast
+
+import "fmt"
+
+/*
+REWRITING THE AST
+
+Apply walks an AST like Walk does, but it lets the funcs it calls change the AST as it goes;
+replace a node with another one, delete it, or insert nodes before or after it.
+
+eg to replace every 1 + 1 with 2;
+
+	ast.Apply(program, nil, func(c *ast.Cursor) bool {
+		if infix, ok := c.Node().(*ast.InfixExpression); ok && infix.String() == "(1 + 1)" {
+			c.Replace(&ast.IntegerLiteral{Token: infix.Token, Value: 2})
+		}
+		return true
+	})
+*/
+
+// An ApplyFunc is called by Apply with a Cursor that points at the node being walked, which may be nil.
+type ApplyFunc func(*Cursor) bool
+
+/*
+Apply walks the AST root in the same order as Walk, and returns it with the changes that pre and post made to it.
+It calls pre for each node on the way down and post on the way back up; nil children included, so that they can be
+replaced too.
+
+If pre returns false, Apply skips the children of that node and does not call post for it.
+If post returns false, Apply stops right away.
+
+Changes to the lists of nodes(eg the Statements of a Program) are seen by the rest of the walk; a deleted node is not
+walked. But the nodes that a Cursor puts into the AST(with Replace, InsertBefore or InsertAfter) are not walked.
+A node has to fit the place it is put in; eg a *LetStatement can not replace an Expression. Apply panics if it does not.
+*/
+func Apply(root Node, pre, post ApplyFunc) (result Node) {
+	result = root
+	defer func() {
+		if r := recover(); r != nil && r != stop {
+			panic(r)
+		}
+	}()
+	a := &applier{pre: pre, post: post}
+	a.visit(&Cursor{node: root, set: func(n Node) { result = n }})
+	return result
+}
+
+// stop is what the walk panics with when post returns false, to get out of it in one go. Apply recovers it.
+var stop = new(int)
+
+/*
+A Cursor points at the node that Apply is at, and is how an ApplyFunc changes the AST there.
+It is only valid during the call of the ApplyFunc it was passed to.
+*/
+type Cursor struct {
+	node   Node
+	parent Node
+	name   string
+
+	set func(Node) // puts a node in the place of node; if node is not in a list
+
+	list  nodeList // the list that node is in; if it is in one
+	index int      // where node is in list
+	next  int      // the index of the node that comes after node in list; moves when nodes are inserted or deleted
+}
+
+// Node returns the node the cursor is at.
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the node that the node the cursor is at is a child of. The root has no parent.
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Name returns the name of the field of Parent that has the node in it; eg "Statements" or "Right".
+func (c *Cursor) Name() string { return c.name }
+
+// Index returns the index of the node in its list(eg the Statements of a Program), or -1 if it is not in a list.
+func (c *Cursor) Index() int {
+	if c.list == nil {
+		return -1
+	}
+	return c.index
+}
+
+// Replace puts n in the place of the node. n is not walked.
+func (c *Cursor) Replace(n Node) {
+	if c.list != nil {
+		c.list.set(c.index, n)
+		return
+	}
+	c.set(n)
+}
+
+// Delete removes the node from its list. It panics if the node is not in a list.
+func (c *Cursor) Delete() {
+	c.mustBeInList("Delete")
+	c.list.remove(c.index)
+	c.next--
+}
+
+// InsertAfter puts n in the list of the node, right after it. n is not walked. It panics if the node is not in a list.
+func (c *Cursor) InsertAfter(n Node) {
+	c.mustBeInList("InsertAfter")
+	c.list.insert(c.index+1, n)
+	c.next++
+}
+
+// InsertBefore puts n in the list of the node, right before it. n is not walked. It panics if the node is not in a list.
+func (c *Cursor) InsertBefore(n Node) {
+	c.mustBeInList("InsertBefore")
+	c.list.insert(c.index, n)
+	c.index++
+	c.next++
+}
+
+func (c *Cursor) mustBeInList(method string) {
+	if c.list == nil {
+		panic(fmt.Sprintf("ast: %s on a %T that is not in a list", method, c.node))
+	}
+}
+
+type applier struct {
+	pre, post ApplyFunc
+}
+
+// visit calls pre and post for the node of c, and walks its children in between.
+func (a *applier) visit(c *Cursor) {
+	if isNil(c.node) {
+		c.node = nil
+	}
+	if a.pre != nil && !a.pre(c) {
+		return
+	}
+	a.children(c.node)
+	if a.post != nil && !a.post(c) {
+		panic(stop)
+	}
+}
+
+// child visits the child of parent in the field name. set puts another node in that field.
+func (a *applier) child(parent Node, name string, child Node, set func(Node)) {
+	a.visit(&Cursor{node: child, parent: parent, name: name, set: set})
+}
+
+// each visits the nodes in the list of parent in the field name; including the ones that the ApplyFuncs move there.
+func (a *applier) each(parent Node, name string, list nodeList) {
+	for i := 0; i < list.len(); {
+		c := &Cursor{node: list.get(i), parent: parent, name: name, list: list, index: i, next: i + 1}
+		a.visit(c)
+		i = c.next
+	}
+}
+
+// children visits the children of n, in the same order as Walk does.
+func (a *applier) children(n Node) {
+	switch n := n.(type) {
+	case nil:
+	case *Program:
+		a.each(n, "Statements", statementList{&n.Statements})
+	case *LetStatement:
+		a.child(n, "Name", n.Name, func(x Node) { n.Name = asIdentifier(x) })
+		a.child(n, "Value", n.Value, func(x Node) { n.Value = asExpression(x) })
+	case *ReturnStatement:
+		a.child(n, "ReturnValue", n.ReturnValue, func(x Node) { n.ReturnValue = asExpression(x) })
+	case *ExpressionStatement:
+		a.child(n, "Expression", n.Expression, func(x Node) { n.Expression = asExpression(x) })
+	case *BlockStatement:
+		a.each(n, "Statements", statementList{&n.Statements})
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean:
+		// nothing to do
+	case *PrefixExpression:
+		a.child(n, "Right", n.Right, func(x Node) { n.Right = asExpression(x) })
+	case *InfixExpression:
+		a.child(n, "Left", n.Left, func(x Node) { n.Left = asExpression(x) })
+		a.child(n, "Right", n.Right, func(x Node) { n.Right = asExpression(x) })
+	case *IfExpression:
+		a.child(n, "Condition", n.Condition, func(x Node) { n.Condition = asExpression(x) })
+		a.child(n, "Consequence", n.Consequence, func(x Node) { n.Consequence = asBlock(x) })
+		a.child(n, "Alternative", n.Alternative, func(x Node) { n.Alternative = asBlock(x) })
+	case *FunctionLiteral:
+		a.each(n, "Parameters", identifierList{&n.Parameters})
+		a.child(n, "Body", n.Body, func(x Node) { n.Body = asBlock(x) })
+	case *CallExpression:
+		a.child(n, "Function", n.Function, func(x Node) { n.Function = asExpression(x) })
+		a.each(n, "Arguments", expressionList{&n.Arguments})
+	default:
+		panic(fmt.Sprintf("ast.Apply: unexpected node type %T", n))
+	}
+}
+
+/*
+nodeList is a list of nodes in the AST that a Cursor can change. There is one for each type of list a node can have,
+since a []Statement can not be used as a []Node.
+*/
+type nodeList interface {
+	len() int
+	get(i int) Node
+	set(i int, n Node)
+	insert(i int, n Node)
+	remove(i int)
+}
+
+type statementList struct{ s *[]Statement }
+
+func (l statementList) len() int          { return len(*l.s) }
+func (l statementList) get(i int) Node    { return (*l.s)[i] }
+func (l statementList) set(i int, n Node) { (*l.s)[i] = asStatement(n) }
+func (l statementList) insert(i int, n Node) {
+	s := asStatement(n)
+	*l.s = append(*l.s, nil)
+	copy((*l.s)[i+1:], (*l.s)[i:])
+	(*l.s)[i] = s
+}
+func (l statementList) remove(i int) { *l.s = append((*l.s)[:i], (*l.s)[i+1:]...) }
+
+type expressionList struct{ s *[]Expression }
+
+func (l expressionList) len() int          { return len(*l.s) }
+func (l expressionList) get(i int) Node    { return (*l.s)[i] }
+func (l expressionList) set(i int, n Node) { (*l.s)[i] = asExpression(n) }
+func (l expressionList) insert(i int, n Node) {
+	e := asExpression(n)
+	*l.s = append(*l.s, nil)
+	copy((*l.s)[i+1:], (*l.s)[i:])
+	(*l.s)[i] = e
+}
+func (l expressionList) remove(i int) { *l.s = append((*l.s)[:i], (*l.s)[i+1:]...) }
+
+type identifierList struct{ s *[]*Identifier }
+
+func (l identifierList) len() int          { return len(*l.s) }
+func (l identifierList) get(i int) Node    { return (*l.s)[i] }
+func (l identifierList) set(i int, n Node) { (*l.s)[i] = asIdentifier(n) }
+func (l identifierList) insert(i int, n Node) {
+	ident := asIdentifier(n)
+	*l.s = append(*l.s, nil)
+	copy((*l.s)[i+1:], (*l.s)[i:])
+	(*l.s)[i] = ident
+}
+func (l identifierList) remove(i int) { *l.s = append((*l.s)[:i], (*l.s)[i+1:]...) }
+
+/*
+The as funcs convert a node that an ApplyFunc wants to put in the AST to the type of the place it goes in.
+A nil node is fine; it empties the place. A node of the wrong type is a bug in the ApplyFunc, so they panic.
+*/
+
+func asStatement(n Node) Statement {
+	s, ok := n.(Statement)
+	if !ok && n != nil {
+		panic(fmt.Sprintf("ast: a %T is not a Statement", n))
+	}
+	return s
+}
+
+func asExpression(n Node) Expression {
+	e, ok := n.(Expression)
+	if !ok && n != nil {
+		panic(fmt.Sprintf("ast: a %T is not an Expression", n))
+	}
+	return e
+}
+
+func asIdentifier(n Node) *Identifier {
+	ident, ok := n.(*Identifier)
+	if !ok && n != nil {
+		panic(fmt.Sprintf("ast: a %T is not an *Identifier", n))
+	}
+	return ident
+}
+
+func asBlock(n Node) *BlockStatement {
+	block, ok := n.(*BlockStatement)
+	if !ok && n != nil {
+		panic(fmt.Sprintf("ast: a %T is not a *BlockStatement", n))
+	}
+	return block
+}
@@ -0,0 +1,177 @@
+package ast_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/komuw/cali/ast"
+	"github.com/komuw/cali/token"
+)
+
+func TestApplyReplace(t *testing.T) {
+	program := parse(t, "", "let x = 1 + 2 * 3; fn(x) { x + y; };")
+
+	// constant-fold integer arithmetic and rename x to z.
+	result := ast.Apply(program, nil, func(c *ast.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.Identifier:
+			if n.Value == "x" {
+				c.Replace(&ast.Identifier{Token: n.Token, Value: "z"})
+			}
+		case *ast.InfixExpression:
+			left, lok := n.Left.(*ast.IntegerLiteral)
+			right, rok := n.Right.(*ast.IntegerLiteral)
+			if !lok || !rok {
+				return true
+			}
+			switch n.Operator {
+			case "+":
+				c.Replace(&ast.IntegerLiteral{Token: n.Token, Value: left.Value + right.Value})
+			case "*":
+				c.Replace(&ast.IntegerLiteral{Token: n.Token, Value: left.Value * right.Value})
+			}
+		}
+		return true
+	})
+
+	if result != program {
+		t.Fatalf("\n Apply returned a different root. \ngot %v \nwanted %v", result, program)
+	}
+	let := program.Statements[0].(*ast.LetStatement)
+	if let.Name.Value != "z" {
+		t.Errorf("\n name not replaced. \ngot %q \nwanted %q", let.Name.Value, "z")
+	}
+	if lit, ok := let.Value.(*ast.IntegerLiteral); !ok || lit.Value != 7 {
+		t.Errorf("\n value not folded. \ngot %q \nwanted %q", let.Value.String(), "7")
+	}
+	fn := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if got, expected := fn.String(), "fn(z) { (z + y); }"; got != expected {
+		t.Errorf("\n function not rewritten. \ngot %q \nwanted %q", got, expected)
+	}
+}
+
+func TestApplyDeleteAndInsert(t *testing.T) {
+	program := parse(t, "", "let a = 1; let b = 2; let c = 3;")
+
+	var visited []string
+	ast.Apply(program, func(c *ast.Cursor) bool {
+		let, ok := c.Node().(*ast.LetStatement)
+		if !ok {
+			return true
+		}
+		visited = append(visited, let.Name.Value)
+		switch let.Name.Value {
+		case "a":
+			// nodes inserted by the cursor are not visited.
+			c.InsertAfter(letStatement("after"))
+		case "b":
+			c.Delete()
+		case "c":
+			c.InsertBefore(letStatement("before"))
+			if c.Index() != 3 {
+				t.Errorf("\n wrong index after InsertBefore. \ngot %d \nwanted %d", c.Index(), 3)
+			}
+		}
+		return false
+	}, nil)
+
+	if got, expected := program.String(), "let a = 1;let after = 0;let before = 0;let c = 3;"; got != expected {
+		t.Errorf("\n wrong program. \ngot %q \nwanted %q", got, expected)
+	}
+	if got, expected := visited, []string{"a", "b", "c"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("\n wrong visited nodes. \ngot %q \nwanted %q", got, expected)
+	}
+}
+
+func TestApplyLists(t *testing.T) {
+	program := parse(t, "", "fn(a, b) { add(a, b); };")
+
+	// swap the parameters for one named c, and give every call an extra first argument.
+	ast.Apply(program, func(c *ast.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.Identifier:
+			if c.Name() == "Parameters" && n.Value == "a" {
+				c.Delete()
+			} else if c.Name() == "Parameters" && n.Value == "b" {
+				c.Replace(letStatement("c").Name)
+			}
+		}
+		if c.Name() == "Arguments" && c.Index() == 0 {
+			c.InsertBefore(&ast.Boolean{Token: token.Token{Type: token.TRUE, Value: "true"}, Value: true})
+		}
+		return true
+	}, nil)
+
+	if got, expected := program.String(), "fn(c) { add(true, a, b); };"; got != expected {
+		t.Errorf("\n wrong program. \ngot %q \nwanted %q", got, expected)
+	}
+}
+
+func TestApplyRoot(t *testing.T) {
+	program := parse(t, "", "5;")
+	replacement := &ast.Program{Statements: []ast.Statement{letStatement("x")}}
+
+	result := ast.Apply(program, func(c *ast.Cursor) bool {
+		if _, ok := c.Node().(*ast.Program); ok {
+			c.Replace(replacement)
+		}
+		return false
+	}, nil)
+	if result != replacement {
+		t.Errorf("\n root not replaced. \ngot %v \nwanted %v", result, replacement)
+	}
+}
+
+func TestApplyStop(t *testing.T) {
+	program := parse(t, "", "a; b; c;")
+
+	var visited []string
+	ast.Apply(program, nil, func(c *ast.Cursor) bool {
+		if ident, ok := c.Node().(*ast.Identifier); ok {
+			visited = append(visited, ident.Value)
+			return ident.Value != "b"
+		}
+		return true
+	})
+	if len(visited) != 2 || visited[1] != "b" {
+		t.Errorf("\n traversal did not stop at b. \ngot %q", visited)
+	}
+}
+
+func TestApplyPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		f    ast.ApplyFunc
+	}{
+		{"delete outside slice", func(c *ast.Cursor) bool {
+			if _, ok := c.Node().(*ast.Identifier); ok {
+				c.Delete()
+			}
+			return true
+		}},
+		{"wrong node type", func(c *ast.Cursor) bool {
+			if _, ok := c.Node().(*ast.IntegerLiteral); ok {
+				c.Replace(letStatement("x"))
+			}
+			return true
+		}},
+	}
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("\n %s: Apply did not panic", tt.name)
+				}
+			}()
+			ast.Apply(parse(t, "", "let a = 1;"), tt.f, nil)
+		}()
+	}
+}
+
+func letStatement(name string) *ast.LetStatement {
+	return &ast.LetStatement{
+		Token: token.Token{Type: token.LET, Value: "let"},
+		Name:  &ast.Identifier{Token: token.Token{Type: token.IDENT, Value: name}, Value: name},
+		Value: &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Value: "0"}, Value: 0},
+	}
+}
@@ -0,0 +1,170 @@
+package ast
+
+import (
+	"fmt"
+
+	"github.com/komuw/cali/token"
+)
+
+/*
+WALKING THE AST
+
+Walk and Inspect visit every node of an AST, so that analyses(eg find every identifier that is used) do not have to
+type-switch over every kind of node to find its children.
+To change an AST while walking it, see Apply.
+*/
+
+/*
+Walk calls Visit for every node it comes to. The Visitor that Visit returns is the one that gets the children of
+that node, and then a nil node to say that they are done. If it returns nil, the children are skipped.
+*/
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+/*
+Walk visits node with v, and then each of its children that is not nil with the Visitor that v.Visit returned for it;
+depth first, and in the order they appear in the source code. eg for a *LetStatement, Name and then Value.
+node must not be nil.
+*/
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+	case *LetStatement:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+	case *ReturnStatement:
+		if n.ReturnValue != nil {
+			Walk(v, n.ReturnValue)
+		}
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			Walk(v, n.Expression)
+		}
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean:
+		// nothing to do
+	case *PrefixExpression:
+		if n.Right != nil {
+			Walk(v, n.Right)
+		}
+	case *InfixExpression:
+		if n.Left != nil {
+			Walk(v, n.Left)
+		}
+		if n.Right != nil {
+			Walk(v, n.Right)
+		}
+	case *IfExpression:
+		if n.Condition != nil {
+			Walk(v, n.Condition)
+		}
+		if n.Consequence != nil {
+			Walk(v, n.Consequence)
+		}
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			if param != nil {
+				Walk(v, param)
+			}
+		}
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+	case *CallExpression:
+		if n.Function != nil {
+			Walk(v, n.Function)
+		}
+		for _, arg := range n.Arguments {
+			if arg != nil {
+				Walk(v, arg)
+			}
+		}
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, stmts []Statement) {
+	for _, s := range stmts {
+		if s != nil {
+			Walk(v, s)
+		}
+	}
+}
+
+// inspector turns a func into a Visitor; see Inspect
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+/*
+Inspect is Walk with a func instead of a Visitor. f returns whether to go on to the children of a node; after the
+children of a node, f is called with nil. node must not be nil.
+eg to find all the identifiers in a program;
+
+	ast.Inspect(program, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok {
+			fmt.Println(ident.Value)
+		}
+		return true
+	})
+*/
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// nodeToken returns the token of n. A *Program has no token of its own, it returns the zero token for it.
+func nodeToken(n Node) token.Token {
+	switch n := n.(type) {
+	case *LetStatement:
+		return n.Token
+	case *ReturnStatement:
+		return n.Token
+	case *ExpressionStatement:
+		return n.Token
+	case *BlockStatement:
+		return n.Token
+	case *Identifier:
+		return n.Token
+	case *IntegerLiteral:
+		return n.Token
+	case *FloatLiteral:
+		return n.Token
+	case *StringLiteral:
+		return n.Token
+	case *Boolean:
+		return n.Token
+	case *PrefixExpression:
+		return n.Token
+	case *InfixExpression:
+		return n.Token
+	case *IfExpression:
+		return n.Token
+	case *FunctionLiteral:
+		return n.Token
+	case *CallExpression:
+		return n.Token
+	}
+	return token.Token{}
+}
@@ -0,0 +1,93 @@
+package ast_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/komuw/cali/ast"
+)
+
+// recorder is a Visitor that records every node it visits.
+type recorder struct {
+	visited []string
+}
+
+func (r *recorder) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		r.visited = append(r.visited, "nil")
+		return nil
+	}
+	r.visited = append(r.visited, fmt.Sprintf("%T %s", node, node.TokenValue()))
+	return r
+}
+
+func TestWalk(t *testing.T) {
+	program := parse(t, "", "let a = fn(x) { return -x; }; a(1 + 2);")
+	r := &recorder{}
+	ast.Walk(r, program)
+
+	expected := []string{
+		"*ast.Program let",
+		"*ast.LetStatement let",
+		"*ast.Identifier a",
+		"nil",
+		"*ast.FunctionLiteral fn",
+		"*ast.Identifier x",
+		"nil",
+		"*ast.BlockStatement {",
+		"*ast.ReturnStatement return",
+		"*ast.PrefixExpression -",
+		"*ast.Identifier x",
+		"nil",
+		"nil",
+		"nil",
+		"nil",
+		"nil",
+		"nil",
+		"*ast.ExpressionStatement a",
+		"*ast.CallExpression (",
+		"*ast.Identifier a",
+		"nil",
+		"*ast.InfixExpression +",
+		"*ast.IntegerLiteral 1",
+		"nil",
+		"*ast.IntegerLiteral 2",
+		"nil",
+		"nil",
+		"nil",
+		"nil",
+		"nil",
+	}
+	if !reflect.DeepEqual(r.visited, expected) {
+		t.Errorf("\n wrong visit order. \ngot %q \nwanted %q", r.visited, expected)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	program := parse(t, "", "let a = 1; if (a < b) { c; } else { fn(d) { e; }; }")
+
+	var idents []string
+	ast.Inspect(program, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok {
+			idents = append(idents, ident.Value)
+		}
+		return true
+	})
+	if expected := []string{"a", "a", "b", "c", "d", "e"}; !reflect.DeepEqual(idents, expected) {
+		t.Errorf("\n wrong identifiers. \ngot %q \nwanted %q", idents, expected)
+	}
+
+	// returning false skips the children of a node.
+	idents = nil
+	ast.Inspect(program, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok {
+			idents = append(idents, ident.Value)
+		}
+		_, isFunc := n.(*ast.FunctionLiteral)
+		return !isFunc
+	})
+	if expected := []string{"a", "a", "b", "c"}; !reflect.DeepEqual(idents, expected) {
+		t.Errorf("\n wrong identifiers. \ngot %q \nwanted %q", idents, expected)
+	}
+}
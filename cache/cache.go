@@ -0,0 +1,283 @@
+/*
+Package cache skips parsing for source code that has been parsed before.
+
+Parsing a big script takes time, and scripts are often run many times without being changed.
+So we hash the source code and keep the AST that parsing it produced. When the same source code comes again,
+we return the AST we kept instead of parsing it again.
+
+There are two levels;
+
+	memory  an LRU of the most recently used ASTs.
+	disk    an optional directory with one file per AST, so that the ASTs outlive the process.
+
+A Key is the hash of the source code, its filename(the filename is part of every position in the AST)
+and parser.Version. So a new version of cali never uses an AST made by an old one.
+*/
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/komuw/cali/ast"
+	"github.com/komuw/cali/lexer"
+	"github.com/komuw/cali/parser"
+)
+
+// Key identifies a parsed program; see KeyOf
+type Key [sha256.Size]byte
+
+// KeyOf returns the key for the source code src of the file filename.
+func KeyOf(filename string, src []byte) Key {
+	h := sha256.New()
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], parser.Version)
+	h.Write(buf[:])
+	// write the length of filename first so that, eg; filename "a" + src "b" and filename "ab" + src "" differ.
+	binary.BigEndian.PutUint64(buf[:], uint64(len(filename)))
+	h.Write(buf[:])
+	h.Write([]byte(filename))
+	h.Write(src)
+
+	var k Key
+	copy(k[:], h.Sum(nil))
+	return k
+}
+
+// String returns the key in hex; it is also the name of the key's file in the disk cache.
+func (k Key) String() string {
+	return hex.EncodeToString(k[:])
+}
+
+/*
+Stats counts how the cache has been doing.
+A lookup that is found in memory is a Hit. One that is only found on disk is a Hit and a DiskHit.
+*/
+type Stats struct {
+	Hits      int
+	DiskHits  int
+	Misses    int
+	Evictions int // ASTs dropped from memory to make room for new ones. They stay on disk.
+}
+
+// entry is what the LRU list holds.
+type entry struct {
+	key     Key
+	program *ast.Program
+}
+
+/*
+Cache is a cache of parsed programs. It is safe for concurrent use.
+
+The programs it returns are shared; callers must not modify them.
+*/
+type Cache struct {
+	mu       sync.Mutex
+	capacity int
+	dir      string
+	lru      *list.List // front is the most recently used
+	entries  map[Key]*list.Element
+	stats    Stats
+}
+
+/*
+New returns a cache that keeps up to capacity programs in memory.
+If dir is not empty, programs are also stored in files under dir, which is created if it does not exist.
+*/
+func New(capacity int, dir string) (*Cache, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Cache{
+		capacity: capacity,
+		dir:      dir,
+		lru:      list.New(),
+		entries:  make(map[Key]*list.Element),
+	}, nil
+}
+
+/*
+Parse returns the program for src; from the cache if it is there, else by parsing src.
+Only programs without parse errors are cached. So for src with errors, Parse parses it every time and returns the errors.
+*/
+func (c *Cache) Parse(filename string, src []byte) (*ast.Program, parser.ErrorList) {
+	key := KeyOf(filename, src)
+	if program := c.Get(key); program != nil {
+		return program, nil
+	}
+
+	p := parser.NewParser(lexer.NewFileLexer(filename, string(src)))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		return program, errs
+	}
+	c.Put(key, program)
+	return program, nil
+}
+
+// Get returns the program for key, or nil if it is not in the cache.
+func (c *Cache) Get(key Key) *ast.Program {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(elem)
+		c.stats.Hits++
+		return elem.Value.(*entry).program
+	}
+	if program := c.load(key); program != nil {
+		c.add(key, program)
+		c.stats.Hits++
+		c.stats.DiskHits++
+		return program
+	}
+	c.stats.Misses++
+	return nil
+}
+
+/*
+Put adds program to the cache under key.
+Failing to write it to disk is not an error; the program is still cached in memory.
+*/
+func (c *Cache) Put(key Key, program *ast.Program) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(elem)
+		elem.Value.(*entry).program = program
+	} else {
+		c.add(key, program)
+	}
+	c.store(key, program)
+}
+
+// Invalidate removes the program for key from memory and from disk.
+func (c *Cache) Invalidate(key Key) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+	if c.dir != "" {
+		os.Remove(c.path(key))
+	}
+}
+
+/*
+Purge removes all programs from memory and from disk.
+It only removes the files that the cache created; other files in the cache dir are left alone.
+*/
+func (c *Cache) Purge() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.entries = make(map[Key]*list.Element)
+	if c.dir == "" {
+		return nil
+	}
+	files, err := filepath.Glob(filepath.Join(c.dir, "*"+fileExt))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats returns the stats of the cache so far.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Len returns the number of programs in memory.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// add adds program to the front of the LRU, evicting the least recently used program if the cache is full.
+func (c *Cache) add(key Key, program *ast.Program) {
+	if c.capacity <= 0 {
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&entry{key: key, program: program})
+	for c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).key)
+		c.stats.Evictions++
+	}
+}
+
+// fileExt is the extension of the files in the disk cache.
+const fileExt = ".ast"
+
+func (c *Cache) path(key Key) string {
+	return filepath.Join(c.dir, key.String()+fileExt)
+}
+
+/*
+load reads the program for key from disk.
+The files hold the binary encoding of the program; see ast.Program.MarshalBinary
+A file that can not be decoded(eg it was written by another version of cali) is removed and treated as missing.
+*/
+func (c *Cache) load(key Key) *ast.Program {
+	if c.dir == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil
+	}
+	program := &ast.Program{}
+	if err := program.UnmarshalBinary(data); err != nil {
+		os.Remove(c.path(key))
+		return nil
+	}
+	return program
+}
+
+/*
+store writes program to disk.
+It writes to a temporary file first and then renames it, so that other processes never see a partly written file.
+*/
+func (c *Cache) store(key Key, program *ast.Program) {
+	if c.dir == "" {
+		return
+	}
+	data, err := program.MarshalBinary()
+	if err != nil {
+		return
+	}
+	f, err := os.CreateTemp(c.dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
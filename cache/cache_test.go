@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const src = `let add = fn(x, y) { x + y; };
+let s = "jambo";
+if (add(1, 2.5) > 3) { -0x2A; } else { 99999999999999999999; }
+`
+
+func TestKeyOf(t *testing.T) {
+	k := KeyOf("main.cali", []byte(src))
+	if k != KeyOf("main.cali", []byte(src)) {
+		t.Errorf("\n same input produced different keys")
+	}
+	if k == KeyOf("other.cali", []byte(src)) {
+		t.Errorf("\n different filenames produced the same key")
+	}
+	if k == KeyOf("main.cali", []byte(src+" ")) {
+		t.Errorf("\n different source code produced the same key")
+	}
+	if KeyOf("a", []byte("b")) == KeyOf("ab", []byte("")) {
+		t.Errorf("\n filename and source code are not kept apart")
+	}
+}
+
+func TestCacheParse(t *testing.T) {
+	c, err := New(10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, errs := c.Parse("main.cali", []byte(src))
+	if len(errs) != 0 {
+		t.Fatalf("\n unexpected parse errors: %q", errs)
+	}
+	second, errs := c.Parse("main.cali", []byte(src))
+	if len(errs) != 0 {
+		t.Fatalf("\n unexpected parse errors: %q", errs)
+	}
+	if first != second {
+		t.Errorf("\n second Parse did not return the cached program")
+	}
+	expected := Stats{Hits: 1, Misses: 1}
+	if c.Stats() != expected {
+		t.Errorf("\n wrong stats. \ngot %#+v \nwanted %#+v", c.Stats(), expected)
+	}
+}
+
+func TestCacheParseErrorsNotCached(t *testing.T) {
+	c, err := New(10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		_, errs := c.Parse("main.cali", []byte("let = 5;"))
+		if len(errs) != 1 {
+			t.Fatalf("\n number of errors mismatch. \ngot %q \nwanted %d", errs, 1)
+		}
+	}
+	if c.Len() != 0 {
+		t.Errorf("\n program with errors was cached")
+	}
+	expected := Stats{Misses: 2}
+	if c.Stats() != expected {
+		t.Errorf("\n wrong stats. \ngot %#+v \nwanted %#+v", c.Stats(), expected)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c, err := New(2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Parse("a.cali", []byte("1;"))
+	c.Parse("b.cali", []byte("2;"))
+	c.Parse("a.cali", []byte("1;")) // a is now the most recently used, so b is evicted next.
+	c.Parse("c.cali", []byte("3;"))
+
+	if c.Len() != 2 {
+		t.Errorf("\n wrong Len. \ngot %d \nwanted %d", c.Len(), 2)
+	}
+	if c.Get(KeyOf("a.cali", []byte("1;"))) == nil {
+		t.Errorf("\n most recently used program was evicted")
+	}
+	if c.Get(KeyOf("b.cali", []byte("2;"))) != nil {
+		t.Errorf("\n least recently used program was not evicted")
+	}
+	expected := Stats{Hits: 2, Misses: 4, Evictions: 1}
+	if c.Stats() != expected {
+		t.Errorf("\n wrong stats. \ngot %#+v \nwanted %#+v", c.Stats(), expected)
+	}
+}
+
+func TestCacheDisk(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cali")
+	c, err := New(10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, errs := c.Parse("main.cali", []byte(src))
+	if len(errs) != 0 {
+		t.Fatalf("\n unexpected parse errors: %q", errs)
+	}
+
+	// a new cache, like in a new process, finds the program on disk.
+	c, err = New(10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromDisk, errs := c.Parse("main.cali", []byte(src))
+	if len(errs) != 0 {
+		t.Fatalf("\n unexpected parse errors: %q", errs)
+	}
+	if fromDisk.String() != program.String() {
+		t.Errorf("\n program from disk is different. \ngot %q \nwanted %q", fromDisk.String(), program.String())
+	}
+	if fromDisk.Pos() != program.Pos() {
+		t.Errorf("\n positions lost on disk. \ngot %#+v \nwanted %#+v", fromDisk.Pos(), program.Pos())
+	}
+	expected := Stats{Hits: 1, DiskHits: 1}
+	if c.Stats() != expected {
+		t.Errorf("\n wrong stats. \ngot %#+v \nwanted %#+v", c.Stats(), expected)
+	}
+
+	// now it is in memory too.
+	c.Parse("main.cali", []byte(src))
+	expected = Stats{Hits: 2, DiskHits: 1}
+	if c.Stats() != expected {
+		t.Errorf("\n wrong stats. \ngot %#+v \nwanted %#+v", c.Stats(), expected)
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := KeyOf("main.cali", []byte(src))
+	c.Parse("main.cali", []byte(src))
+	c.Invalidate(key)
+	if c.Get(key) != nil {
+		t.Errorf("\n program is still cached after Invalidate")
+	}
+	if _, err := os.Stat(c.path(key)); !os.IsNotExist(err) {
+		t.Errorf("\n file is still on disk after Invalidate: %v", err)
+	}
+}
+
+func TestCachePurge(t *testing.T) {
+	dir := t.TempDir()
+	other := filepath.Join(dir, "README")
+	if err := os.WriteFile(other, []byte("not ours"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Parse("a.cali", []byte("1;"))
+	c.Parse("b.cali", []byte("2;"))
+	if err := c.Purge(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 0 {
+		t.Errorf("\n wrong Len after Purge. \ngot %d \nwanted %d", c.Len(), 0)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 1 || files[0] != other {
+		t.Errorf("\n wrong files left after Purge. \ngot %q \nwanted %q", files, []string{other})
+	}
+}
+
+func TestCacheCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := KeyOf("main.cali", []byte(src))
+	if err := os.WriteFile(c.path(key), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	program, errs := c.Parse("main.cali", []byte(src))
+	if len(errs) != 0 || program == nil {
+		t.Fatalf("\n corrupt file was not treated as a miss: %q", errs)
+	}
+	expected := Stats{Misses: 1}
+	if c.Stats() != expected {
+		t.Errorf("\n wrong stats. \ngot %#+v \nwanted %#+v", c.Stats(), expected)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change; the same as diff -u
+const diffContext = 3
+
+// edit is a line of a diff. op is ' ' for a line in both files, '-' for a line only in the old one, '+' for one only in the new one.
+type edit struct {
+	op   byte
+	line string
+}
+
+/*
+unifiedDiff returns the changes from old to new in the unified diff format(see diff -u), or nil if there are none.
+It is what cali fmt -d prints; so that it can be read by people and applied with patch.
+*/
+func unifiedDiff(oldName, newName string, old, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	edits := diffLines(splitLines(old), splitLines(new))
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	oldLine, newLine := 1, 1 // the line numbers of edits[i]
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// a hunk starts diffContext lines before a change and ends diffContext lines after the last change
+		// that is at most 2*diffContext lines after the one before it.
+		// Hunks never overlap; the previous one ended more than diffContext lines before start.
+		start := max(i-diffContext, 0)
+		end := i + 1
+		for j := i; j < len(edits) && j-end <= 2*diffContext; j++ {
+			if edits[j].op != ' ' {
+				end = j + 1
+			}
+		}
+		end = min(end+diffContext, len(edits))
+
+		hunkOld, hunkNew := oldLine-(i-start), newLine-(i-start)
+		var oldCount, newCount int
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				oldCount++
+			}
+			if e.op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(hunkOld, oldCount), hunkRange(hunkNew, newCount))
+		for _, e := range edits[start:end] {
+			out.WriteByte(e.op)
+			out.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		oldLine, newLine = hunkOld+oldCount, hunkNew+newCount
+		i = end
+	}
+	return out.Bytes()
+}
+
+// hunkRange formats the range of lines of a hunk; an empty range is given as the line before it, like diff -u does.
+func hunkRange(line, count int) string {
+	if count == 0 {
+		line--
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// splitLines splits s into lines; each keeps its \n. The last line has none if s does not end with one.
+func splitLines(s []byte) []string {
+	lines := strings.SplitAfter(string(s), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+/*
+diffLines returns the shortest list of edits that turns a into b.
+It uses the O(ND) algorithm of Eugene Myers, "An O(ND) Difference Algorithm and Its Variations";
+which is fast when a and b are mostly the same, as they are for source code before and after formatting.
+It is the linear space variant from section 4b of the paper; a file where every line changed must not take memory
+that grows with the square of its length.
+*/
+func diffLines(a, b []string) []edit {
+	d := &differ{a: a, b: b}
+	size := 2*((len(a)+len(b)+1)/2) + 3
+	d.forward, d.backward = make([]int, size), make([]int, size)
+	d.compare(0, len(a), 0, len(b))
+
+	// like diff -u, show the lines that were deleted by a change before the ones that were inserted.
+	edits := make([]edit, 0, len(d.edits))
+	for i := 0; i < len(d.edits); {
+		if d.edits[i].op == ' ' {
+			edits = append(edits, d.edits[i])
+			i++
+			continue
+		}
+		end := i
+		for end < len(d.edits) && d.edits[end].op != ' ' {
+			end++
+		}
+		for _, op := range []byte{'-', '+'} {
+			for _, e := range d.edits[i:end] {
+				if e.op == op {
+					edits = append(edits, e)
+				}
+			}
+		}
+		i = end
+	}
+	return edits
+}
+
+// differ has what diffLines needs while it splits up the lines to compare.
+type differ struct {
+	a, b  []string
+	edits []edit
+	// the furthest x reached on each diagonal k(= x - y), from the start and from the end; indexed by k+len/2+1.
+	forward, backward []int
+}
+
+// compare appends the edits that turn a[aLo:aHi] into b[bLo:bHi].
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	// the lines that are the same at the start and at the end are not part of any change.
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.edits = append(d.edits, edit{' ', d.a[aLo]})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-suffix-1] == d.b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi, bHi = aHi-suffix, bHi-suffix
+
+	switch {
+	case aLo == aHi:
+		for _, line := range d.b[bLo:bHi] {
+			d.edits = append(d.edits, edit{'+', line})
+		}
+	case bLo == bHi:
+		for _, line := range d.a[aLo:aHi] {
+			d.edits = append(d.edits, edit{'-', line})
+		}
+	default:
+		x, y := d.middle(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		d.compare(x, aHi, y, bHi)
+	}
+
+	for _, line := range d.a[aHi : aHi+suffix] {
+		d.edits = append(d.edits, edit{' ', line})
+	}
+}
+
+/*
+middle returns a point(x, y) on a shortest path of edits from (aLo, bLo) to (aHi, bHi), about halfway along it.
+It searches from both ends at the same time until the searches meet. Since a[aLo:aHi] and b[bLo:bHi] are not empty and
+neither start nor end with the same line, the point is never one of the two ends; so compare always makes progress.
+*/
+func (d *differ) middle(aLo, aHi, bLo, bHi int) (x, y int) {
+	a, b := d.a[aLo:aHi], d.b[bLo:bHi]
+	n, m := len(a), len(b)
+	delta := n - m // the diagonal that the end is on
+	odd := delta%2 != 0
+	half := (n + m + 1) / 2
+	offset := len(d.forward) / 2
+	// the backward search works like the forward one, with x and y counted from the end.
+	forward, backward := d.forward, d.backward
+	forward[offset+1], backward[offset+1] = 0, 0
+
+	for step := 0; step <= half; step++ {
+		for k := -step; k <= step; k += 2 {
+			if k == -step || (k != step && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1] // down; a line of b is inserted
+			} else {
+				x = forward[offset+k-1] + 1 // right; a line of a is deleted
+			}
+			y = x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			// the backward search is one step behind; it has reached the diagonals within step-1 of the end.
+			if back := delta - k; odd && -(step-1) <= back && back <= step-1 && x+backward[offset+back] >= n {
+				return aLo + x, bLo + y
+			}
+		}
+		for k := -step; k <= step; k += 2 {
+			if k == -step || (k != step && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y = x - k
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if front := delta - k; !odd && -step <= front && front <= step && x+forward[offset+front] >= n {
+				return aLo + n - x, bLo + m - y
+			}
+		}
+	}
+	panic("unreachable: the forward and backward searches of a diff always meet")
+}
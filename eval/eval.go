@@ -0,0 +1,501 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/komuw/cali/ast"
+	"github.com/komuw/cali/object"
+	"github.com/komuw/cali/token"
+)
+
+/*
+EVALUATION
+
+The evaluator is a tree-walking interpreter. It takes the AST produced by the parser and
+interprets it "on the fly", without any preprocessing or compilation step.
+
+Eval takes an ast.Node and returns the object.Object it evaluates to.
+It calls itself recursively on the children of node. eg for the AST of;
+	5 + 5;
+it evaluates the left and the right *ast.IntegerLiteral and then applies the + operator to the two results.
+*/
+
+/*
+There is only ever one true, one false and one null. So instead of allocating a new object every time
+we encounter them, we reference these. This also means we can compare them by pointer.
+*/
+var (
+	NULL  = &object.Null{}
+	TRUE  = &object.Boolean{Value: true}
+	FALSE = &object.Boolean{Value: false}
+)
+
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	// Statements
+	case *ast.Program:
+		return evalProgram(node, env)
+	case *ast.ExpressionStatement:
+		return Eval(node.Expression, env)
+	case *ast.BlockStatement:
+		return evalBlockStatement(node, env)
+	case *ast.ReturnStatement:
+		val := Eval(node.ReturnValue, env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+	case *ast.LetStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		env.Set(node.Name.Value, val)
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInteger{Value: node.Big}
+		}
+		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+	case *ast.IfExpression:
+		return evalIfExpression(node, env)
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+	case *ast.PrefixExpression:
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalPrefixExpression(node.Token.Pos, node.Operator, right)
+	case *ast.InfixExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalInfixExpression(node.Token.Pos, node.Operator, left, right)
+	case *ast.FunctionLiteral:
+		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+	case *ast.CallExpression:
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		return applyFunction(node.Token.Pos, function, args)
+	}
+	return nil
+}
+
+/*
+evalProgram evaluates the statements of a program one after the other.
+If it encounters a return value it unwraps it and stops; return 10; 9; evaluates to 10.
+If it encounters an error it also stops.
+*/
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+	for _, statement := range program.Statements {
+		result = Eval(statement, env)
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+	return result
+}
+
+/*
+evalBlockStatement differs from evalProgram in that it does NOT unwrap return values.
+In nested blocks the return value has to bubble all the way up, so that the outer blocks stop too.
+A block that produces no value(eg an empty one, or one with only let statements) evaluates to NULL; the block of an
+if is an expression, and a Go nil would crash whatever uses it.
+*/
+func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+	for _, statement := range block.Statements {
+		result = Eval(statement, env)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+/*
+evalExpressions evaluates exps from left to right.
+If one of them evaluates to an error, it stops and returns only that error.
+*/
+func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+	for _, e := range exps {
+		evaluated := Eval(e, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+	return result
+}
+
+/*
+applyFunction calls fn with args.
+The body of the function is evaluated in a new environment, enclosed by the environment the function was defined in,
+in which the parameters are bound to the arguments.
+A return statement in the body must only stop the function; not the whole program. So we unwrap the return value.
+*/
+func applyFunction(pos token.Position, fn object.Object, args []object.Object) object.Object {
+	function, ok := fn.(*object.Function)
+	if !ok {
+		return newError(pos, "not a function: %s", fn.Type())
+	}
+	if len(args) != len(function.Parameters) {
+		return newError(pos, "wrong number of arguments: want=%d, got=%d", len(function.Parameters), len(args))
+	}
+	extendedEnv := extendFunctionEnv(function, args)
+	evaluated := Eval(function.Body, extendedEnv)
+	return unwrapReturnValue(evaluated)
+}
+
+func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+	env := object.NewEnclosedEnvironment(fn.Env)
+	for i, param := range fn.Parameters {
+		env.Set(param.Value, args[i])
+	}
+	return env
+}
+
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+	return obj
+}
+
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	val, ok := env.Get(node.Value)
+	if !ok {
+		return newError(node.Pos(), "identifier not found: %s", node.Value)
+	}
+	return val
+}
+
+func evalPrefixExpression(pos token.Position, operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return evalBangOperatorExpression(right)
+	case "-":
+		return evalMinusPrefixOperatorExpression(pos, right)
+	default:
+		return newError(pos, "unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+/*
+evalBangOperatorExpression decides what is "truthy" in cali.
+Everything that is not false or null is truthy; so !5 is false.
+*/
+func evalBangOperatorExpression(right object.Object) object.Object {
+	switch right {
+	case TRUE:
+		return FALSE
+	case FALSE:
+		return TRUE
+	case NULL:
+		return TRUE
+	default:
+		return FALSE
+	}
+}
+
+func evalMinusPrefixOperatorExpression(pos token.Position, right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		if right.Value == math.MinInt64 {
+			return normalizeInteger(new(big.Int).Neg(big.NewInt(right.Value)))
+		}
+		return &object.Integer{Value: -right.Value}
+	case *object.BigInteger:
+		return normalizeInteger(new(big.Int).Neg(right.Value))
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return newError(pos, "unknown operator: -%s", right.Type())
+	}
+}
+
+/*
+evalInfixExpression dispatches on the types of the operands.
+Booleans can only be compared with == and !=; since TRUE and FALSE are singletons we compare them by pointer.
+Integers and floats can be mixed; see evalFloatInfixExpression.
+*/
+func evalInfixExpression(pos token.Position, operator string, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(pos, operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(pos, operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(pos, operator, left, right)
+	case left.Type() != right.Type():
+		return newError(pos, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	default:
+		return newError(pos, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+/*
+evalIntegerInfixExpression never lets an integer overflow.
+When the result of +, -, * or / does not fit in an int64, the operation is redone with math/big
+and the result is an *object.BigInteger; see evalBigIntegerInfixExpression.
+*/
+func evalIntegerInfixExpression(pos token.Position, operator string, left, right object.Object) object.Object {
+	leftInt, leftOk := left.(*object.Integer)
+	rightInt, rightOk := right.(*object.Integer)
+	if !leftOk || !rightOk {
+		return evalBigIntegerInfixExpression(pos, operator, left, right)
+	}
+	leftVal := leftInt.Value
+	rightVal := rightInt.Value
+
+	switch operator {
+	case "+":
+		sum := leftVal + rightVal
+		if (leftVal > 0 && rightVal > 0 && sum < 0) || (leftVal < 0 && rightVal < 0 && sum >= 0) {
+			return evalBigIntegerInfixExpression(pos, operator, left, right)
+		}
+		return &object.Integer{Value: sum}
+	case "-":
+		diff := leftVal - rightVal
+		if (leftVal >= 0 && rightVal < 0 && diff < 0) || (leftVal < 0 && rightVal > 0 && diff >= 0) {
+			return evalBigIntegerInfixExpression(pos, operator, left, right)
+		}
+		return &object.Integer{Value: diff}
+	case "*":
+		product := leftVal * rightVal
+		if leftVal != 0 && (product/leftVal != rightVal || (leftVal == -1 && rightVal == math.MinInt64)) {
+			return evalBigIntegerInfixExpression(pos, operator, left, right)
+		}
+		return &object.Integer{Value: product}
+	case "/":
+		if rightVal == 0 {
+			return newError(pos, "division by zero: %d / %d", leftVal, rightVal)
+		}
+		if leftVal == math.MinInt64 && rightVal == -1 {
+			return evalBigIntegerInfixExpression(pos, operator, left, right)
+		}
+		return &object.Integer{Value: leftVal / rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError(pos, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+/*
+evalBigIntegerInfixExpression is evalIntegerInfixExpression for integers that are, or whose result is, too big for an int64.
+Division truncates towards zero just like it does for int64; -7 / 2 is -3
+*/
+func evalBigIntegerInfixExpression(pos token.Position, operator string, left, right object.Object) object.Object {
+	leftVal := toBigInt(left)
+	rightVal := toBigInt(right)
+
+	switch operator {
+	case "+":
+		return normalizeInteger(new(big.Int).Add(leftVal, rightVal))
+	case "-":
+		return normalizeInteger(new(big.Int).Sub(leftVal, rightVal))
+	case "*":
+		return normalizeInteger(new(big.Int).Mul(leftVal, rightVal))
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newError(pos, "division by zero: %s / %s", leftVal, rightVal)
+		}
+		return normalizeInteger(new(big.Int).Quo(leftVal, rightVal))
+	case "<":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+	default:
+		return newError(pos, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// toBigInt converts an *object.Integer or *object.BigInteger into a *big.Int
+func toBigInt(obj object.Object) *big.Int {
+	if i, ok := obj.(*object.Integer); ok {
+		return big.NewInt(i.Value)
+	}
+	return obj.(*object.BigInteger).Value
+}
+
+/*
+normalizeInteger returns an *object.Integer if value fits in an int64, else an *object.BigInteger.
+This way we only pay for math/big when we really have to.
+*/
+func normalizeInteger(value *big.Int) object.Object {
+	if value.IsInt64() {
+		return &object.Integer{Value: value.Int64()}
+	}
+	return &object.BigInteger{Value: value}
+}
+
+/*
+evalFloatInfixExpression is used when at least one of the operands is a float.
+An integer operand is promoted to a float first, so; 1 + 2.5 is 3.5 and 5 / 2.0 is 2.5
+Note that 5 / 2 is still 2 since both operands are integers.
+Just like for integers, dividing by zero is an error and not +Inf.
+*/
+func evalFloatInfixExpression(pos token.Position, operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError(pos, "division by zero: %s / %s", left.Inspect(), right.Inspect())
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError(pos, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// isNumber reports whether obj is an integer or a float.
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat converts a number(see isNumber) into a float64.
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInteger:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	default:
+		return obj.(*object.Float).Value
+	}
+}
+
+/*
+evalStringInfixExpression supports concatenation with + and comparison with == and !=
+Strings are not singletons like TRUE and FALSE, so they are compared by value and not by pointer.
+*/
+func evalStringInfixExpression(pos token.Position, operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError(pos, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+/*
+evalIfExpression evaluates the consequence if the condition is truthy, else the alternative.
+An if without an else whose condition is not truthy produces NULL; if (false) { 10; }
+*/
+func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := Eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+	if isTruthy(condition) {
+		return Eval(ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		return Eval(ie.Alternative, env)
+	} else {
+		return NULL
+	}
+}
+
+// isTruthy follows the same rules as the ! operator; everything but false and null is truthy.
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+// newError creates an error object that points at pos in the source code.
+func newError(pos token.Position, format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Pos: pos}
+}
+
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	}
+	return false
+}
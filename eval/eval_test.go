@@ -0,0 +1,508 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/komuw/cali/lexer"
+	"github.com/komuw/cali/object"
+	"github.com/komuw/cali/parser"
+)
+
+func testEval(t *testing.T, input string) object.Object {
+	l := lexer.NewLexer(input)
+	p := parser.NewParser(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %q", input, p.Errors())
+	}
+	env := object.NewEnvironment()
+	return Eval(program, env)
+}
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5;", 5},
+		{"10;", 10},
+		{"-5;", -5},
+		{"-10;", -10},
+		{"5 + 5 + 5 + 5 - 10;", 10},
+		{"2 * 2 * 2 * 2 * 2;", 32},
+		{"-50 + 100 + -50;", 0},
+		{"5 * 2 + 10;", 20},
+		{"5 + 2 * 10;", 25},
+		{"20 + 2 * -10;", 0},
+		{"50 / 2 * 2 + 10;", 60},
+		{"3 * 3 * 3 + 10;", 37},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1;", "9223372036854775808"},
+		{"-9223372036854775807 - 2;", "-9223372036854775809"},
+		{"-9223372036854775808 - 1;", "-9223372036854775809"},
+		{"4294967296 * 4294967296;", "18446744073709551616"},
+		{"-9223372036854775807 - 1;", "-9223372036854775808"},
+		{"let min = -9223372036854775807 - 1; -min;", "9223372036854775808"},
+		{"let min = -9223372036854775807 - 1; min / -1;", "9223372036854775808"},
+		{"let min = -9223372036854775807 - 1; min * -1;", "9223372036854775808"},
+		{"99999999999999999999 * 10;", "999999999999999999990"},
+		{"-99999999999999999999 / 2;", "-49999999999999999999"},
+		{"100000000000000000000000 - 99999999999999999999999;", "1"},
+		{"9223372036854775808 > 9223372036854775807;", "true"},
+		{"18446744073709551616 == 4294967296 * 4294967296;", "true"},
+		{"9223372036854775808 + 0.5;", "9.223372036854776e+18"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestBigIntegerNormalized(t *testing.T) {
+	evaluated := testEval(t, "(9223372036854775807 + 1) - 1;")
+	testIntegerObject(t, evaluated, 9223372036854775807)
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"4.5;", 4.5},
+		{"-4.5;", -4.5},
+		{"1.5 + 1.5;", 3},
+		{"1 + 2.5;", 3.5},
+		{"2.5 * 2;", 5},
+		{"5 / 2.0;", 2.5},
+		{"10 - 0.5;", 9.5},
+		{"1e3 + 0x10;", 1016},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		result, ok := evaluated.(*object.Float)
+		if !ok {
+			t.Errorf("object is not Float for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if result.Value != tt.expected {
+			t.Errorf("object has wrong value for %q. got=%g, want=%g", tt.input, result.Value, tt.expected)
+		}
+	}
+}
+
+func TestMixedNumberComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 < 1.5;", true},
+		{"2.5 > 3;", false},
+		{"2 == 2.0;", true},
+		{"2 != 2.0;", false},
+		{"0.1 + 0.2 == 0.3;", false},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"42.0;", "42.0"},
+		{"4.25;", "4.25"},
+		{"5 / 2.0;", "2.5"},
+		{"1e21;", "1e+21"},
+		{"-0.5;", "-0.5"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect for %q. got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 < 2;", true},
+		{"1 > 2;", false},
+		{"1 < 1;", false},
+		{"1 == 1;", true},
+		{"1 != 1;", false},
+		{"1 == 2;", false},
+		{"1 != 2;", true},
+		{"let a = 1 < 2; let b = 2 > 1; a == b;", true},
+		{"let a = 1 < 2; let b = 2 > 1; a != b;", false},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!5;", false},
+		{"!!5;", true},
+		{"let a = 1 < 2; !a;", false},
+		{"let a = 1 < 2; !!a;", true},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let t = 1 < 2; 5 + t;", "type mismatch: INTEGER + BOOLEAN"},
+		{"let t = 1 < 2; 5 + t; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"let t = 1 < 2; -t;", "unknown operator: -BOOLEAN"},
+		{"let t = 1 < 2; t + t;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"let t = 1 < 2; 5; t + t; 5;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"let t = 1 < 2; return t + t; 5;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"foobar;", "identifier not found: foobar"},
+		{"10 / 0;", "division by zero: 10 / 0"},
+		{"10 / 0.0;", "division by zero: 10 / 0.0"},
+		{"99999999999999999999 / 0;", "division by zero: 99999999999999999999 / 0"},
+		{"let t = 1 < 2; 99999999999999999999 + t;", "type mismatch: INTEGER + BOOLEAN"},
+		{"let t = 1 < 2; 1.5 + t;", "type mismatch: FLOAT + BOOLEAN"},
+		{"let s = \"a\"; 1.5 * s;", "type mismatch: FLOAT * STRING"},
+		// a block without a value is NULL, not a crash.
+		{"let x = if (true) {}; x + 1;", "type mismatch: NULL + INTEGER"},
+		{"-if (true) {};", "unknown operator: -NULL"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"foobar;", "ERROR: 1:1: identifier not found: foobar"},
+		{"let a = 1;\nlet t = 1 < 2;\na + t;", "ERROR: 3:3: type mismatch: INTEGER + BOOLEAN"},
+		{"let t = 1 < 2;\n  -t;", "ERROR: 2:3: unknown operator: -BOOLEAN"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(t, input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v", fn.Parameters)
+	}
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+	expectedBody := "{ (x + 2); }"
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5);", 5},
+		{"let f = fn(x) { return x; x + 10; }; f(10);", 10},
+		{"let f = fn(x) { let y = x * 2; return y; }; f(10) + 1;", 21},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+	let newAdder = fn(x) {
+		fn(y) { x + y; };
+	};
+	let addTwo = newAdder(2);
+	addTwo(2);`
+
+	testIntegerObject(t, testEval(t, input), 4)
+}
+
+func TestFunctionParametersShadow(t *testing.T) {
+	input := `
+	let x = 10;
+	let f = fn(x) { x; };
+	f(1);
+	x;`
+
+	testIntegerObject(t, testEval(t, input), 10)
+}
+
+func TestFunctionErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let x = 5; x(1);", "not a function: INTEGER"},
+		{"let f = fn(x, y) { x; }; f(1);", "wrong number of arguments: want=2, got=1"},
+		{"let f = fn(x) { x; }; f(y);", "identifier not found: y"},
+		{"let f = fn(x) { let t = 1 < 2; x + t; }; f(1); 5;", "type mismatch: INTEGER + BOOLEAN"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10; }", 10},
+		{"if (false) { 10; }", nil},
+		{"if (1) { 10; }", 10},
+		{"if (1 < 2) { 10; }", 10},
+		{"if (1 > 2) { 10; }", nil},
+		{"if (1 > 2) { 10; } else { 20; }", 20},
+		{"if (1 < 2) { 10; } else { 20; }", 10},
+		{"let x = if (1 < 2) { 10; } else { 20; }; x * 2;", 20},
+		{"if (true) { }", nil},
+		{"if (true) { let y = 5; }", nil},
+		{"if (false) { 10; } else { }", nil},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else if evaluated != NULL {
+			t.Errorf("object is not NULL. got=%T (%+v)", evaluated, evaluated)
+		}
+	}
+}
+
+func TestBooleanLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true;", true},
+		{"false;", false},
+		{"!true;", false},
+		{"!!false;", false},
+		{"true == true;", true},
+		{"true != false;", true},
+		{"(1 < 2) == true;", true},
+		{"(1 > 2) == true;", false},
+	}
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestNestedReturns(t *testing.T) {
+	input := `
+	if (10 > 1) {
+		if (10 > 1) {
+			return 10;
+		}
+		return 1;
+	}`
+	testIntegerObject(t, testEval(t, input), 10)
+
+	input = `
+	let f = fn(x) {
+		if (x > 1) {
+			return x * f(x - 1);
+		}
+		return 1;
+	};
+	f(5);`
+	testIntegerObject(t, testEval(t, input), 120)
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello World!";`
+
+	evaluated := testEval(t, input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"Hello" + " " + "World!";`, "Hello World!"},
+		{`let greet = fn(name) { "Habari " + name; }; greet("yako");`, "Habari yako"},
+		{`"a\n" + "\u{e9}";`, "a\né"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. got=%q, want=%q", str.Value, tt.expected)
+		}
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a";`, true},
+		{`"a" == "b";`, false},
+		{`"a" != "b";`, true},
+		{`"a" + "b" == "ab";`, true},
+	}
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`"Hello" - "World";`, "unknown operator: STRING - STRING"},
+		{`"Hello" + 1;`, "type mismatch: STRING + INTEGER"},
+		{`-"Hello";`, "unknown operator: -STRING"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+/*
+Package format prints cali source code in the one canonical style, like gofmt does for Go.
+
+ast.Program.String() is for debugging; it puts everything on one line and adds parentheses around every operator.
+The printer in this package instead writes;
+
+	one statement per line, indented with one tab per block
+	one space around infix operators and after commas
+	parentheses only where the precedence of the operators needs them
+	the comments of the source code, in the same place relative to the code
+	at most one empty line between statements, where the source code had some
+
+Formatting formatted code does not change it, and the formatted code parses to the same AST as the original code.
+*/
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/komuw/cali/ast"
+	"github.com/komuw/cali/lexer"
+	"github.com/komuw/cali/parser"
+	"github.com/komuw/cali/token"
+)
+
+/*
+Source formats src, the source code of the file filename.
+If src can not be parsed, Source returns the parse errors; a parser.ErrorList
+*/
+func Source(filename string, src []byte) ([]byte, error) {
+	p := parser.NewParser(lexer.NewFileLexer(filename, string(src)))
+	program := p.ParseProgram()
+	if err := p.Errors().Err(); err != nil {
+		return nil, err
+	}
+
+	pr := &printer{}
+	// the parser drops comments, so we lex src a second time to get them.
+	l := lexer.NewFileLexer(filename, string(src))
+	l.KeepComments = true
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type == token.COMMENT {
+			pr.comments = append(pr.comments, tok)
+		}
+	}
+
+	pr.program(program)
+	return pr.out.Bytes(), nil
+}
+
+/*
+Node writes node, formatted, to w. node is an *ast.Program, an ast.Statement or an ast.Expression
+The AST has no comments in it, so unlike Source, Node can not print any.
+*/
+func Node(w io.Writer, node ast.Node) error {
+	pr := &printer{}
+	switch n := node.(type) {
+	case *ast.Program:
+		pr.program(n)
+	case ast.Statement:
+		pr.statement(n)
+	case ast.Expression:
+		pr.expression(n, parser.OpLowest)
+	default:
+		return fmt.Errorf("format: unsupported node type %T", node)
+	}
+	_, err := w.Write(pr.out.Bytes())
+	return err
+}
+
+/*
+printer writes an AST to out.
+
+Comments are printed as the tokens around them are printed; before writing a token from the source code,
+the printer writes the comments that came before it. Tokens that are not in the AST(like the ; that ends a statement)
+have no position, so comments next to them are printed with the next token that has one.
+*/
+type printer struct {
+	out      bytes.Buffer
+	indent   int
+	comments []token.Token // the comments that have not been printed yet, in the order they appear in the source code
+	lastLine int           // the line in the source code of the last token or comment printed; 0 if unknown
+}
+
+// write writes s as is.
+func (p *printer) write(s string) {
+	p.out.WriteString(s)
+}
+
+/*
+token writes s, the value of a token at pos.
+Comments before pos are written first, inline; that is only the case for comments in the middle of an expression.
+*/
+func (p *printer) token(pos token.Position, s string) {
+	if pos.Line > 0 {
+		for len(p.comments) > 0 && p.comments[0].Pos.Offset < pos.Offset {
+			c := p.comments[0]
+			p.comments = p.comments[1:]
+			p.write(c.Value)
+			if isLineComment(c) {
+				// the rest of the expression goes on the next line, indented one more than the statement.
+				p.write("\n" + strings.Repeat("\t", p.indent+1))
+			} else {
+				p.write(" ")
+			}
+		}
+		p.lastLine = pos.Line
+	}
+	p.write(s)
+}
+
+/*
+newline ends the current line, and the empty lines after it, and indents the next one.
+One empty line is kept if the source code had any between the last thing printed and pos; unless trim is set.
+*/
+func (p *printer) newline(pos token.Position, trim bool) {
+	if p.out.Len() == 0 {
+		return
+	}
+	p.write("\n")
+	if !trim && p.lastLine > 0 && pos.Line > p.lastLine+1 {
+		p.write("\n")
+	}
+	p.write(strings.Repeat("\t", p.indent))
+}
+
+/*
+flushComments writes the comments before pos; each on its own line.
+Except for a comment that starts on the same line as the code before it, which stays at the end of that line.
+If pos is invalid, all comments are written.
+first is set if nothing has been written in the current block yet; it returns whether that is still the case.
+*/
+func (p *printer) flushComments(pos token.Position, first bool) bool {
+	for len(p.comments) > 0 && (pos.Line == 0 || p.comments[0].Pos.Offset < pos.Offset) {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		if p.lastLine > 0 && c.Pos.Line == p.lastLine && p.out.Len() > 0 {
+			p.write(" ")
+		} else {
+			p.newline(c.Pos, first)
+		}
+		p.write(c.Value)
+		p.lastLine = c.End.Line
+		first = false
+	}
+	return first
+}
+
+func isLineComment(c token.Token) bool {
+	return strings.HasPrefix(c.Value, "//")
+}
+
+func (p *printer) program(program *ast.Program) {
+	p.statements(program.Statements, true)
+	p.flushComments(token.Position{}, false)
+	if p.out.Len() > 0 {
+		p.write("\n")
+	}
+}
+
+/*
+statements writes each statement of stmts on its own line, with the comments before them.
+Like flushComments, it takes and returns whether nothing has been written in the current block yet.
+*/
+func (p *printer) statements(stmts []ast.Statement, first bool) bool {
+	for _, s := range stmts {
+		first = p.flushComments(s.Pos(), first)
+		p.newline(s.Pos(), first)
+		p.statement(s)
+		first = false
+	}
+	return first
+}
+
+func (p *printer) statement(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.token(s.Token.Pos, "let ")
+		p.token(s.Name.Token.Pos, s.Name.Value)
+		p.write(" = ")
+		p.expression(s.Value, parser.OpLowest)
+		p.write(";")
+	case *ast.ReturnStatement:
+		p.token(s.Token.Pos, "return ")
+		p.expression(s.ReturnValue, parser.OpLowest)
+		p.write(";")
+	case *ast.ExpressionStatement:
+		switch e := s.Expression.(type) {
+		case *ast.IfExpression:
+			// like after a block, there is no ; after an if.
+			p.expression(e, parser.OpLowest)
+		default:
+			if _, ok := leftmost(e).(*ast.IfExpression); ok {
+				/*
+					An if that starts a statement is parsed as a whole statement; see parser.parseExpressionStatement
+					So to keep eg; (if (x) { 1; } else { 2; }) + 3; the same, it needs the parentheses.
+				*/
+				p.write("(")
+				p.expression(e, parser.OpLowest)
+				p.write(");")
+				return
+			}
+			p.expression(e, parser.OpLowest)
+			p.write(";")
+		}
+	case *ast.BlockStatement:
+		p.block(s)
+	default:
+		panic(fmt.Sprintf("format: unexpected statement type %T", s))
+	}
+}
+
+/*
+block writes a block; its statements are indented one more than the block itself.
+The comments before the } of the block are at the end of the block, and not after it.
+*/
+func (p *printer) block(b *ast.BlockStatement) {
+	p.token(b.Token.Pos, "{")
+	end, ok := b.Rbrace, b.Rbrace.Pos.IsValid()
+	hasComments := ok && len(p.comments) > 0 && p.comments[0].Pos.Offset < end.Pos.Offset
+	if len(b.Statements) == 0 && !hasComments {
+		p.token(end.Pos, "}")
+		return
+	}
+
+	p.indent++
+	first := p.statements(b.Statements, true)
+	if ok {
+		p.flushComments(end.Pos, first)
+	}
+	p.indent--
+	p.newline(end.Pos, true)
+	p.token(end.Pos, "}")
+}
+
+/*
+expression writes e. It is put in parentheses if it binds less tightly than prec;
+eg (1 + 2) * 3 needs parentheses around 1 + 2 since + has a lower precedence than *
+*/
+func (p *printer) expression(e ast.Expression, prec int) {
+	if precedence(e) < prec {
+		p.write("(")
+		defer p.write(")")
+	}
+
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.token(e.Token.Pos, e.Value)
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.Boolean:
+		// the literal as it was written; eg 0x2A stays 0x2A
+		p.token(e.Pos(), e.String())
+	case *ast.StringLiteral:
+		p.token(e.Token.Pos, e.String())
+	case *ast.PrefixExpression:
+		p.token(e.Token.Pos, e.Operator)
+		p.expression(e.Right, parser.OpPrefix)
+	case *ast.InfixExpression:
+		prec := precedence(e)
+		p.expression(e.Left, prec)
+		p.write(" ")
+		p.token(e.Token.Pos, e.Operator)
+		p.write(" ")
+		// operators are left associative; 1 - (2 - 3) needs the parentheses, (1 - 2) - 3 does not.
+		p.expression(e.Right, prec+1)
+	case *ast.CallExpression:
+		p.expression(e.Function, parser.OpCall)
+		p.token(e.Token.Pos, "(")
+		for i, arg := range e.Arguments {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(arg, parser.OpLowest)
+		}
+		p.write(")")
+	case *ast.FunctionLiteral:
+		p.token(e.Token.Pos, "fn(")
+		for i, param := range e.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.token(param.Token.Pos, param.Value)
+		}
+		p.write(") ")
+		p.block(e.Body)
+	case *ast.IfExpression:
+		p.token(e.Token.Pos, "if (")
+		p.expression(e.Condition, parser.OpLowest)
+		p.write(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.write(" else ")
+			p.block(e.Alternative)
+		}
+	default:
+		panic(fmt.Sprintf("format: unexpected expression type %T", e))
+	}
+}
+
+/*
+precedence returns how tightly e binds; see the parser.Op* constants.
+Expressions without operators bind the tightest, they never need parentheses.
+*/
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(e.Token.Type)
+	case *ast.PrefixExpression:
+		return parser.OpPrefix
+	case *ast.CallExpression:
+		return parser.OpCall
+	}
+	return parser.OpCall + 1
+}
+
+// leftmost returns the expression that e starts with; eg the 1 of 1 + 2 * 3
+func leftmost(e ast.Expression) ast.Expression {
+	for {
+		switch n := e.(type) {
+		case *ast.InfixExpression:
+			if precedence(n.Left) < precedence(n) {
+				// printed in parentheses, so it does not start with n.Left
+				return e
+			}
+			e = n.Left
+		case *ast.CallExpression:
+			if precedence(n.Function) < parser.OpCall {
+				return e
+			}
+			e = n.Function
+		default:
+			return e
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package format_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/komuw/cali/ast"
+	"github.com/komuw/cali/format"
+	"github.com/komuw/cali/lexer"
+	"github.com/komuw/cali/parser"
+	"github.com/komuw/cali/token"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"let x=5;", "let x = 5;\n"},
+		{"let x = 5;let y = 6;", "let x = 5;\nlet y = 6;\n"},
+		{"let add=fn(x,y){return x+y;};", "let add = fn(x, y) {\n\treturn x + y;\n};\n"},
+		{"let f = fn() { };", "let f = fn() {};\n"},
+		{"add( 1 ,2 );", "add(1, 2);\n"},
+		{`let s = "a\tb\u{1F600}";`, "let s = \"a\\tb\U0001F600\";\n"},
+		{"0x2A + 1.5e3;", "0x2A + 1.5e3;\n"},
+		{"if(x>y){x;}else{y;}", "if (x > y) {\n\tx;\n} else {\n\ty;\n}\n"},
+		{"if (x) { if (y) { z; } }", "if (x) {\n\tif (y) {\n\t\tz;\n\t}\n}\n"},
+
+		// only the parentheses that are needed are kept.
+		{"(1 + 2) * 3;", "(1 + 2) * 3;\n"},
+		{"1 + (2 * 3);", "1 + 2 * 3;\n"},
+		{"(1 - 2) - 3;", "1 - 2 - 3;\n"},
+		{"1 - (2 - 3);", "1 - (2 - 3);\n"},
+		{"-(1 + 2);", "-(1 + 2);\n"},
+		{"(-1) + 2;", "-1 + 2;\n"},
+		{"!(true == false);", "!(true == false);\n"},
+		{"(a < b) == (c > d);", "a < b == c > d;\n"},
+		{"(fn(x) { x; })(5);", "fn(x) {\n\tx;\n}(5);\n"},
+		{"let x = (if (a) { f; } else { g; })(1) + 2;", "let x = if (a) {\n\tf;\n} else {\n\tg;\n}(1) + 2;\n"},
+		// at the start of a statement, an if is a whole statement; so here the parentheses are needed.
+		{"(if (a) { 1; } else { 2; }) + 3;", "(if (a) {\n\t1;\n} else {\n\t2;\n} + 3);\n"},
+
+		// empty lines
+		{"let x = 5;\n\n\n\nlet y = 6;", "let x = 5;\n\nlet y = 6;\n"},
+		{"let f = fn() {\n\n  x;\n\n};", "let f = fn() {\n\tx;\n};\n"},
+
+		// comments
+		{"// c\nlet x = 5;", "// c\nlet x = 5;\n"},
+		{"// c\n\nlet x = 5;", "// c\n\nlet x = 5;\n"},
+		{"let x = 5;   // five\nlet y = 6;", "let x = 5; // five\nlet y = 6;\n"},
+		{"let x = 5; /* five */ let y = 6;", "let x = 5; /* five */\nlet y = 6;\n"},
+		{"let x = 5;\n// the end", "let x = 5;\n// the end\n"},
+		{"let f = fn() { // f\n  x; // x\n  // y\n};", "let f = fn() { // f\n\tx; // x\n\t// y\n};\n"},
+		{"let f = fn() {\n  // nothing\n};", "let f = fn() {\n\t// nothing\n};\n"},
+		{"add(1, /* two */ 2);", "add(1, /* two */ 2);\n"},
+		{"1 + // one\n 2;", "1 + // one\n\t2;\n"},
+		{"/* a /* nested */ comment */", "/* a /* nested */ comment */\n"},
+	}
+	for _, tt := range tests {
+		got, err := format.Source("main.cali", []byte(tt.input))
+		if err != nil {
+			t.Errorf("\n could not format %q: %v", tt.input, err)
+			continue
+		}
+		if string(got) != tt.expected {
+			t.Errorf("\n wrong formatting of %q. \ngot %q \nwanted %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// Formatting must not change what the code means, and formatted code must stay the same when it is formatted again.
+func TestSourceStable(t *testing.T) {
+	tests := []string{
+		"let add = fn(x, y) { return x + y; }; add(1, 2) * -add(3, 4 / 2) != 5;",
+		"let max = fn(a, b) { if (a > b) { a; } else { b; } }; max(1, 2);",
+		"fn(f) { f(f); }(fn(g) { 1 - (2 - (3 - g)); });",
+		"let x = !(!true) == (1 < 2); // x\n/* y */ let y = \"名前\"; 99999999999999999999 * 2.5;",
+		"if (a) { b; } else { c; }\nif (d) { e; }\n-1;",
+	}
+	for _, input := range tests {
+		formatted, err := format.Source("", []byte(input))
+		if err != nil {
+			t.Errorf("\n could not format %q: %v", input, err)
+			continue
+		}
+		if got, expected := parse(t, string(formatted)), parse(t, input); !ast.Equal(got, expected) {
+			t.Errorf("\n formatting changed the AST of %q. \ngot %q \nwanted %q", input, got.String(), expected.String())
+		}
+		again, err := format.Source("", formatted)
+		if err != nil {
+			t.Errorf("\n could not format %q: %v", formatted, err)
+			continue
+		}
+		if !bytes.Equal(again, formatted) {
+			t.Errorf("\n formatting %q again changed it. \ngot %q \nwanted %q", input, again, formatted)
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := format.Source("main.cali", []byte("let x = ;"))
+	var perr *parser.Error
+	if !errors.As(err, &perr) {
+		t.Fatalf("\n expected a parser error, got %v", err)
+	}
+	if perr.Pos.Line != 1 || perr.Pos.Column != 9 {
+		t.Errorf("\n wrong error position. \ngot %v", perr.Pos)
+	}
+}
+
+func TestNode(t *testing.T) {
+	// a node that was not parsed has no positions; which the printer has to cope with.
+	node := &ast.InfixExpression{
+		Token:    token.Token{Type: token.ASTERISK, Value: "*"},
+		Operator: "*",
+		Left: &ast.InfixExpression{
+			Token:    token.Token{Type: token.PLUS, Value: "+"},
+			Operator: "+",
+			Left:     &ast.Identifier{Token: token.Token{Type: token.IDENT, Value: "a"}, Value: "a"},
+			Right:    &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Value: "1"}, Value: 1},
+		},
+		Right: &ast.Identifier{Token: token.Token{Type: token.IDENT, Value: "b"}, Value: "b"},
+	}
+	var out bytes.Buffer
+	if err := format.Node(&out, node); err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := out.String(), "(a + 1) * b"; got != expected {
+		t.Errorf("\n wrong formatting. \ngot %q \nwanted %q", got, expected)
+	}
+
+	out.Reset()
+	if err := format.Node(&out, parse(t, "let f = fn(x) { x; };")); err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := out.String(), "let f = fn(x) {\n\tx;\n};\n"; got != expected {
+		t.Errorf("\n wrong formatting. \ngot %q \nwanted %q", got, expected)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %q", input, p.Errors())
+	}
+	return program
+}
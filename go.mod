@@ -1 +1,3 @@
 module github.com/komuw/cali
+
+go 1.21
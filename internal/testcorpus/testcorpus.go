@@ -0,0 +1,13 @@
+/*
+Package testcorpus has the cali source code that the tests and benchmarks of more than one package use.
+So that eg the lexer and the parser are benchmarked on the same input, and their numbers can be compared.
+*/
+package testcorpus
+
+import "strings"
+
+// Benchmark is a cali program of roughly 1MB, without errors.
+var Benchmark = strings.Repeat(`let add = fn(x, y) { return x + y; };
+let result = add(five, 0x2A) * -3.5; // a comment
+if (result != 10) { "not ten"; } else { "ten"; }
+`, 7000)
@@ -0,0 +1,134 @@
+package lexer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/komuw/cali/token"
+)
+
+/*
+fuzzSeeds is the seed corpus of FuzzLexer; the inputs of the other tests in this package, and the kinds of input that
+lexers tend to get wrong. go test runs FuzzLexer with just these; go test -fuzz=FuzzLexer makes up new inputs from them.
+*/
+var fuzzSeeds = []string{
+	"",
+	`=+(){},;`,
+	"let five = 5;\nlet ten = 10;\nlet add = fn(x, y) {\nx + y;\n};\nlet result = add(five, ten);\n",
+	"!-/*5;\n5 < 10 > 5;\nif (5 < 10) { return true; } else { return false; }\n10 == 10; 10 != 9;",
+	"let s = \"jambo 名前 \\u{1F600}\"; /* a /* nested */ comment */ let z = 0x2A * 4.2e1;\n// the end",
+	"let café = \"😀\";\nlet नमस्ते = 1;",
+	`"a\tb\n\"c\"\\" "\u{0}" "\q" "\u{110000}" "\x8D\xf" "` + "\x8d" + `" "\u{1F60` + "\n",
+	"0x2A 0o52 052 0b101010 4.2 4.2e1 42e-1 1_000_000 1__0 0x 0b102 1e 99999999999999999999",
+	"/* not terminated /* nested */",
+	"let x = 5 @ \xff \"not terminated",
+	"a\x00b \x00",
+	"\r\n\t ;\r",
+	strings.Repeat("let add = fn(x, y) { return x + y; };\nlet result = add(five, 0x2A) * -3.5; // a comment\n", 3),
+}
+
+/*
+FuzzLexer checks that for any input, the lexer;
+
+	stops; it returns EOF after at most one token per byte of input
+	does not panic
+	accounts for every byte of input; each byte is either in a token, or whitespace between tokens
+	gives each token the right position
+	lexes the same when it streams the input from a reader
+*/
+func FuzzLexer(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		l := NewFileLexer("main.cali", input)
+		l.KeepComments = true
+		tokens := checkTokens(t, input, l.NextToken)
+
+		rl := NewReaderLexer("main.cali", iotest.OneByteReader(strings.NewReader(input)))
+		rl.KeepComments = true
+		for i, expected := range tokens {
+			if got := rl.NextToken(); got != expected {
+				t.Fatalf("\n reader lexer differs at token %d of %q. \ngot %#+v \nwanted %#+v", i, input, got, expected)
+			}
+		}
+		if fmt.Sprint(rl.Errors()) != fmt.Sprint(l.Errors()) {
+			t.Errorf("\n reader lexer errors differ for %q. \ngot %q \nwanted %q", input, rl.Errors(), l.Errors())
+		}
+	})
+}
+
+/*
+checkTokens gets the tokens of input from next, up to and including the EOF, and checks that they cover all of input.
+It fails the test if there are more tokens than bytes of input(plus the EOF); the lexer is then stuck.
+*/
+func checkTokens(t *testing.T, input string, next func() token.Token) []token.Token {
+	t.Helper()
+	var tokens []token.Token
+	end := 0 // where the last token ended
+	var pos position
+	for {
+		tok := next()
+		tokens = append(tokens, tok)
+		if len(tokens) > len(input)+1 {
+			t.Fatalf("\n lexer does not stop for %q; %d tokens so far", input, len(tokens))
+		}
+
+		start, stop := tok.Pos.Offset, tok.End.Offset
+		if start < end || stop < start || stop > len(input) {
+			t.Fatalf("\n token %#+v of %q is out of place; the previous token ended at %d", tok, input, end)
+		}
+		if gap := input[end:start]; strings.Trim(gap, " \t\n\r") != "" {
+			t.Fatalf("\n input %q of %q is not part of any token", gap, input)
+		}
+		if pos.advance(input, start); tok.Pos.Line != pos.line || tok.Pos.Column != pos.column {
+			t.Fatalf("\n wrong position for token %#+v of %q. \ngot %d:%d \nwanted %d:%d", tok, input, tok.Pos.Line, tok.Pos.Column, pos.line, pos.column)
+		}
+		end = stop
+
+		if tok.Type == token.EOF {
+			if start != len(input) {
+				t.Fatalf("\n EOF at %d of the %d bytes of %q", start, len(input), input)
+			}
+			return tokens
+		}
+		if stop == start {
+			t.Fatalf("\n empty token %#+v in %q", tok, input)
+		}
+		// the value of a string is the string with its escape sequences replaced, and a line comment leaves out the \r of a
+		// \r\n line ending; all other tokens are as in the input.
+		value := input[start:stop]
+		if tok.Type == token.COMMENT {
+			value = strings.TrimSuffix(value, "\r")
+		}
+		if tok.Type != token.STRING && tok.Value != value {
+			t.Fatalf("\n wrong value for token %#+v of %q. \ngot %q \nwanted %q", tok, input, tok.Value, value)
+		}
+	}
+}
+
+/*
+position works out the line and column of offsets in an input, independently of the lexer; to check the lexer with.
+Columns are counted in chars, like the lexer does. Offsets only ever go forward, so it does not go over the input again.
+*/
+type position struct {
+	offset, line, column int
+}
+
+// advance moves p to offset in input.
+func (p *position) advance(input string, offset int) {
+	if p.line == 0 {
+		p.line, p.column = 1, 1
+	}
+	for _, ch := range input[p.offset:offset] {
+		if ch == '\n' {
+			p.line++
+			p.column = 1
+		} else {
+			p.column++
+		}
+	}
+	p.offset = offset
+}
@@ -1,6 +1,13 @@
 package lexer
 
 import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/komuw/cali/token"
 )
 
@@ -11,21 +18,84 @@ It will take source code as input and output the tokens that rep the source code
 */
 
 type Lexer struct {
+	/*
+		input is all of the source code, for NewLexer. A lexer made by NewReaderLexer instead holds on to a window of it;
+		the token being lexed and the input that has been read ahead, see fill. window[0] is at offset base in the
+		source code. The input is only turned into strings a token at a time; see text.
+	*/
 	input        string
-	ch           byte   // current char under examination
-	position     int    // position of Ch
-	readPosition int    //  next reading position in input (after current char)
-	ByteStream   []byte // value of Input as bytes
+	window       []byte
+	base         int
+	src          io.Reader // where more input comes from; nil once all of it has been read.
+	readErr      error     // the error, other than io.EOF, that reading from src failed with.
+	readErrShown bool      // whether NextToken has returned the token.ILLEGAL token for readErr
+	mark         int       // offset where the token being lexed starts; input before it can be dropped.
+	ch           rune      // current char under examination
+	position     int       // position of Ch
+	readPosition int       //  next reading position in input (after current char)
 
+	filename string // name of the file being lexed, if any. It is attached to the position of every token.
+	line     int    // line of Ch, starting at 1
+	column   int    // column of Ch, starting at 1. It counts chars(runes), not bytes.
+	errors   []*Error
+	errorsMu sync.Mutex // guards errors; they are read by the parser while Tokens lexes in another goroutine.
+
+	/*
+		KeepComments makes NextToken return comments as token.COMMENT tokens, instead of skipping them like whitespace.
+		The parser ignores comment tokens; they are for tools like a formatter, which need to preserve the comments.
+	*/
+	KeepComments bool
 }
 
-func NewLexer(input string) *Lexer {
-	l := &Lexer{input: input}
-	for index := 0; index < len(l.input); index++ {
-		l.ByteStream = append(l.ByteStream, l.input[index])
+/*
+Error is a problem the lexer found in the input; eg a string literal that is not terminated.
+For every such problem, NextToken returns a token.ILLEGAL token that covers the offending input.
+Pos and End delimit the offending part of the input, which can be smaller than the ILLEGAL token;
+eg for "a\qb" it is only the unknown escape sequence \q
+*/
+type Error struct {
+	Pos token.Position
+	End token.Position
+	Msg string
+}
 
-	}
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
 
+/*
+ReadError returns the error that reading the input of a lexer created by NewReaderLexer failed with, or nil.
+Such an error is also one of Errors, but callers may want to tell it apart from errors in the source code itself;
+eg cali exits with a different status for a file that can not be read than for one that can not be parsed.
+It is only known once the lexer has returned token.EOF
+*/
+func (l *Lexer) ReadError() error {
+	return l.readErr
+}
+
+// Errors returns the problems found in the input so far, in the order they were found.
+func (l *Lexer) Errors() []*Error {
+	l.errorsMu.Lock()
+	defer l.errorsMu.Unlock()
+	return l.errors[:len(l.errors):len(l.errors)]
+}
+
+func (l *Lexer) error(pos, end token.Position, format string, a ...interface{}) {
+	l.errorsMu.Lock()
+	defer l.errorsMu.Unlock()
+	l.errors = append(l.errors, &Error{Pos: pos, End: end, Msg: fmt.Sprintf(format, a...)})
+}
+
+func NewLexer(input string) *Lexer {
+	return NewFileLexer("", input)
+}
+
+/*
+NewFileLexer is like NewLexer, but every token it produces carries filename in its position.
+So that errors can read like; program.cali:42:23: expected next token to be ;
+*/
+func NewFileLexer(filename, input string) *Lexer {
+	l := &Lexer{input: input, filename: filename, line: 1, column: 0}
 	/*
 		use readChar, so our *Lexer is in a fully working state b4 anyone calls NextToken()
 	*/
@@ -33,9 +103,104 @@ func NewLexer(input string) *Lexer {
 	return l
 }
 
+/*
+NewReaderLexer is like NewFileLexer, but reads the source code from r as it goes instead of taking all of it up-front.
+Only a window of the input(about readerBufferSize bytes, more if a single token is bigger than that) is kept in memory.
+So multi-megabyte files and pipes can be lexed without loading them whole.
+
+If reading from r fails, the lexer records the error and returns a token.ILLEGAL token for it followed by token.EOF
+*/
+func NewReaderLexer(filename string, r io.Reader) *Lexer {
+	l := &Lexer{src: r, window: make([]byte, 0, 2*readerBufferSize), filename: filename, line: 1, column: 0}
+	l.readChar()
+	return l
+}
+
+// readerBufferSize is how many bytes a lexer created by NewReaderLexer reads from its io.Reader at a time.
+const readerBufferSize = 32 * 1024
+
+/*
+fill makes sure that the input up to(but not including) offset n has been read from l.src, if there is that much input.
+Room for more input is made by dropping the input that comes before l.mark, which no token needs anymore, or else by
+growing the window. The window is only moved down when that frees at least as much room as it has to copy, and it
+doubles when it grows; so for a token of any size, each byte of the input is copied a constant number of times.
+*/
+func (l *Lexer) fill(n int) {
+	for l.src != nil && l.inputEnd() < n {
+		if cap(l.window)-len(l.window) < readerBufferSize {
+			keep := l.mark
+			if l.position < keep {
+				keep = l.position
+			}
+			drop := keep - l.base
+			if drop < 0 {
+				drop = 0
+			}
+			kept := l.window[drop:]
+			window := l.window[:0]
+			if 2*len(kept)+readerBufferSize > cap(l.window) {
+				window = make([]byte, 0, 2*len(kept)+readerBufferSize)
+			}
+			l.window = append(window, kept...)
+			l.base += drop
+		}
+
+		read, err := io.ReadAtLeast(l.src, l.window[len(l.window):cap(l.window)], 1)
+		l.window = l.window[:len(l.window)+read]
+		if err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				l.readErr = err
+			}
+			l.src = nil
+		}
+	}
+}
+
+// inputEnd returns the offset just after the input read so far. Once l.src is nil, that is the end of the input.
+func (l *Lexer) inputEnd() int {
+	if l.window != nil {
+		return l.base + len(l.window)
+	}
+	return len(l.input)
+}
+
+// text returns the input from offset start up to offset end.
+func (l *Lexer) text(start, end int) string {
+	if l.window != nil {
+		return string(l.window[start-l.base : end-l.base])
+	}
+	return l.input[start:end]
+}
+
+// decodeRune returns the char at offset off, and its width in bytes.
+func (l *Lexer) decodeRune(off int) (rune, int) {
+	if l.window != nil {
+		if b := l.window[off-l.base]; b < utf8.RuneSelf {
+			return rune(b), 1
+		}
+		return utf8.DecodeRune(l.window[off-l.base:])
+	}
+	if b := l.input[off]; b < utf8.RuneSelf {
+		return rune(b), 1
+	}
+	return utf8.DecodeRuneInString(l.input[off:])
+}
+
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 	l.skipWhitespace()
+	for l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*') {
+		l.mark = l.position
+		pos := l.pos()
+		tok = l.readComment()
+		if tok.Type == token.ILLEGAL || l.KeepComments {
+			tok.Pos, tok.End = pos, l.pos()
+			return tok
+		}
+		l.skipWhitespace()
+	}
+	l.mark = l.position
+	pos := l.pos()
 
 	switch l.ch {
 	/*
@@ -92,9 +257,25 @@ func (l *Lexer) NextToken() token.Token {
 		tok = token.NewToken(token.LT, l.ch)
 	case '>':
 		tok = token.NewToken(token.GT, l.ch)
+	case '"':
+		tok = l.readString()
+		tok.Pos, tok.End = pos, l.pos()
+		return tok
 	case 0: // ASCII code for "NUL"
+		if !l.atEOF() {
+			// a NUL char in the input is not the end of it; it is just a char that is not allowed.
+			tok = token.Token{Type: token.ILLEGAL, Value: l.text(l.position, l.readPosition)}
+			l.error(pos, l.endPos(), "unexpected character %q", l.ch)
+			break
+		}
 		tok.Value = ""
 		tok.Type = token.EOF
+		if l.readErr != nil && !l.readErrShown && l.atEOF() {
+			// the input was cut short. Report that once, then carry on with EOF.
+			l.error(pos, pos, "could not read input: %v", l.readErr)
+			l.readErrShown = true
+			tok.Type = token.ILLEGAL
+		}
 	default:
 		/*
 			Our lexer needs to  recognize whether the current character is a letter and if so,
@@ -107,13 +288,20 @@ func (l *Lexer) NextToken() token.Token {
 			*/
 			tok.Value = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Value)
+			tok.Pos, tok.End = pos, l.pos()
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Value = l.readNumber()
+			tok = l.readNumber()
+			tok.Pos, tok.End = pos, l.pos()
 			return tok
 		} else {
-			tok = token.NewToken(token.ILLEGAL, l.ch)
+			// use the bytes from the input and not l.ch; for input that is not valid UTF-8, l.ch is utf8.RuneError
+			tok = token.Token{Type: token.ILLEGAL, Value: l.text(l.position, l.readPosition)}
+			if l.ch == utf8.RuneError && l.readPosition-l.position == 1 {
+				l.error(pos, l.endPos(), "invalid UTF-8 encoding")
+			} else {
+				l.error(pos, l.endPos(), "unexpected character %q", l.ch)
+			}
 		}
 
 	}
@@ -123,38 +311,90 @@ func (l *Lexer) NextToken() token.Token {
 		so when we call NextToken() again the l.ch field is already updated
 	*/
 	l.readChar()
+	tok.Pos, tok.End = pos, l.pos()
 	return tok
 }
 
-/* readChar gives us the next character and advance our position in the input string.
-the lexer only supports ASCII characters instead of full Unicode. This lets us keep things simple.
-To support Unicode/UTF-8 we would need to change l.ch from a byte to rune and change the way we read the
-next characters, since they could be multiple bytes wide now. Using l.input[l.readPosition]wouldn’t work anymore
+/*
+pos returns the position of the current char(l.ch).
+At the end of input that is the position just after the last char.
+*/
+func (l *Lexer) pos() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
+}
+
+// endPos returns the position just after the current char(l.ch).
+func (l *Lexer) endPos() token.Position {
+	if l.readPosition > l.inputEnd() {
+		return l.pos()
+	}
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.readPosition,
+		Line:     l.line,
+		Column:   l.column + 1,
+	}
+}
+
+// atEOF reports whether the whole input has been read. l.ch is 0 then, but it is also 0 for a NUL char in the input.
+func (l *Lexer) atEOF() bool {
+	return l.position >= l.inputEnd()
+}
+
+/*
+readChar gives us the next character and advance our position in the input string.
+The input is UTF-8, so a character(rune) can be multiple bytes wide. That is why we decode the input one rune at a time
+instead of using l.input[l.readPosition]; l.position and l.readPosition are still byte offsets into the input.
+Input that is not valid UTF-8 is decoded one byte at a time as utf8.RuneError, which the lexer turns into token.ILLEGAL
 */
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
+	if l.readPosition > l.inputEnd() {
+		// stay put at the end of input, so that the position of the EOF token is stable.
+		return
+	}
+	l.fill(l.readPosition + utf8.UTFMax)
+	if l.ch == '\n' {
+		// we are moving past a newline, so the next char is the first one of a new line.
+		l.line += 1
+		l.column = 0
+	}
+	l.column += 1
+	if l.readPosition == l.inputEnd() {
 		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPosition]
+		l.position = l.inputEnd()
+		l.readPosition = l.inputEnd() + 1
+		return
 	}
+	r, width := l.decodeRune(l.readPosition)
+	l.ch = r
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += width
 }
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || unicode.IsMark(l.ch) {
+		/*
+			combining marks(eg the vowel signs in नमस्ते) can not start an identifier,
+			but they are part of the letter that comes before them.
+		*/
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return l.text(position, l.position)
 }
 
-func isLetter(ch byte) bool {
+func isLetter(ch rune) bool {
 	/*
 		In cali we treat _ as a letter and allow it in identifiers and keywords.
 		That means we can have var names like foo_bar. If you want to allow other chars in ua lang; add them here.
+		Any unicode letter is allowed, not just ASCII ones; so we can have var names like jina, café or 名前
 	*/
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
 /*
@@ -170,24 +410,99 @@ func (l *Lexer) skipWhitespace() {
 }
 
 /*
-We only read intergers. What about floats,hex notation, Octal notation?
-We ignore em and say cali doesn't support them.
+readNumber reads integer and float literals. Just like in Go, we support;
+
+	42         decimal integers
+	0x2A 0X2a  hexadecimal integers
+	0o52 0O52  octal integers(a leading 0 like in 052 also means octal)
+	0b101010   binary integers
+	4.2 4.2e1  floats; with a fraction, an exponent or both. 42e-1 is a float too.
+
+and digits can be separated by _ to make big numbers readable; 1_000_000
+The lexer only checks what it needs to know where the literal ends and whether it is an INT or a FLOAT.
+Converting the literal into a number(and reporting literals like 1__0 that are invalid) is up to the parser.
 */
-func (l *Lexer) readNumber() string {
-	position := l.position
-	for isDigit(l.ch) {
+func (l *Lexer) readNumber() token.Token {
+	start := l.position
+	if l.ch == '0' {
+		switch l.peekChar() {
+		case 'x', 'X':
+			return l.readPrefixedInteger(16, "hexadecimal")
+		case 'o', 'O':
+			return l.readPrefixedInteger(8, "octal")
+		case 'b', 'B':
+			return l.readPrefixedInteger(2, "binary")
+		}
+	}
+
+	tokenType := token.INT
+	l.readDigits()
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
 		l.readChar()
+		l.readDigits()
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		tokenType = token.FLOAT
+		exponent := l.pos()
+		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		if !isDigit(l.ch) {
+			l.error(exponent, l.pos(), "exponent has no digits")
+			return token.Token{Type: token.ILLEGAL, Value: l.text(start, l.position)}
+		}
+		l.readDigits()
 	}
-	return l.input[position:l.position]
+	return token.Token{Type: tokenType, Value: l.text(start, l.position)}
 }
-func isDigit(ch byte) bool {
+
+// readDigits reads decimal digits and the _ used to separate them.
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) || l.ch == '_' {
+		l.readChar()
+	}
+}
+
+/*
+readPrefixedInteger reads integers like 0x2A, 0o52 and 0b101010
+It is called with l.ch being the 0 of the prefix.
+A literal without digits(0x) or with digits that are not valid for the base(0b102) is returned as a token.ILLEGAL
+*/
+func (l *Lexer) readPrefixedInteger(base rune, name string) token.Token {
+	start := l.position
+	l.readChar()
+	prefix := l.pos()
+	l.readChar()
+	valid, digits := true, 0
+	for isHexDigit(l.ch) || isDigit(l.ch) || l.ch == '_' {
+		if l.ch != '_' {
+			digits++
+			if valid && hexValue(l.ch) >= base {
+				valid = false
+				l.error(l.pos(), l.endPos(), "invalid digit %q in %s literal", l.ch, name)
+			}
+		}
+		l.readChar()
+	}
+	if digits == 0 {
+		valid = false
+		l.error(prefix, l.pos(), "%s literal has no digits", name)
+	}
+	if !valid {
+		return token.Token{Type: token.ILLEGAL, Value: l.text(start, l.position)}
+	}
+	return token.Token{Type: token.INT, Value: l.text(start, l.position)}
+}
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
 /*
 We want to support tokens like == and !=
 We can just add a new case in the switch statement inside NextToken() because
-We can’t compare our l.ch byte with strings like "==" ie in Go "==" is a string whereas l.ch is a byte
+We can’t compare our l.ch rune with strings like "==" ie in Go "==" is a string whereas l.ch is a rune
 What we can do instead is to reuse the existing branches for '=' and '!' and extend them.
 So wel'll look ahead in the input and then determine whether to return a token for = or == etc
 
@@ -198,10 +513,171 @@ Some even look behind, and some u have to look ahead/behind for more than one ch
 
 An example of a lookAhead func in a real lexer/parser: https://github.com/Shopify/liquid/pull/235/files#diff-1b4fb3f28c5e976e2074edc03f6cb16cR41
 */
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+func (l *Lexer) peekChar() rune {
+	l.fill(l.readPosition + utf8.UTFMax)
+	if l.readPosition >= l.inputEnd() {
 		return 0
-	} else {
-		return l.input[l.readPosition]
+	}
+	r, _ := l.decodeRune(l.readPosition)
+	return r
+}
+
+/*
+readComment reads a comment. cali has two kinds of comments; a line comment, which starts with two slashes and ends at
+the end of the line, and a block comment, which starts with a slash and a star and ends at the matching star and slash.
+Block comments nest, so that it is possible to comment out code that has comments in it.
+It is called with l.ch being the first / and returns with l.ch being the char after the comment.
+The token's Value is the whole comment, including its delimiters but not the newline that ends a line comment.
+A block comment that is not terminated is returned as a token.ILLEGAL
+*/
+func (l *Lexer) readComment() token.Token {
+	start := l.position
+	startPos := l.pos()
+	l.readChar()
+	if l.ch == '/' {
+		for l.ch != '\n' && !l.atEOF() {
+			l.readChar()
+		}
+		return token.Token{Type: token.COMMENT, Value: strings.TrimSuffix(l.text(start, l.position), "\r")}
+	}
+
+	l.readChar() // the *
+	depth := 1
+	for depth > 0 {
+		switch {
+		case l.atEOF():
+			l.error(startPos, l.pos(), "comment not terminated")
+			return token.Token{Type: token.ILLEGAL, Value: l.text(start, l.position)}
+		case l.ch == '/' && l.peekChar() == '*':
+			l.readChar()
+			depth++
+		case l.ch == '*' && l.peekChar() == '/':
+			l.readChar()
+			depth--
+		}
+		l.readChar()
+	}
+	return token.Token{Type: token.COMMENT, Value: l.text(start, l.position)}
+}
+
+/*
+readString reads a string literal; "hello world"
+It is called with l.ch being the opening " and returns with l.ch being the char after the closing "
+The token's Value is the content of the string with the escape sequences replaced by the chars they stand for;
+
+	\n     newline
+	\t     tab
+	\"     double quote
+	\\     backslash
+	\u{..} the unicode code point with the given hex value; eg \u{1F600}
+	\x..   the byte with the given two digit hex value; eg \x8D. It is for strings that are not valid UTF-8
+
+A string can not span multiple lines; use \n instead.
+If the string is not terminated, or contains an unknown escape sequence, a token.ILLEGAL is returned instead.
+*/
+func (l *Lexer) readString() token.Token {
+	start := l.position
+	startPos := l.pos()
+	valid := true
+	var out strings.Builder
+	for {
+		l.readChar()
+		switch {
+		case l.atEOF() || l.ch == '\n':
+			l.error(startPos, l.pos(), "string literal not terminated")
+			return token.Token{Type: token.ILLEGAL, Value: l.text(start, l.position)}
+		case l.ch == '"':
+			l.readChar()
+			if !valid {
+				return token.Token{Type: token.ILLEGAL, Value: l.text(start, l.position)}
+			}
+			return token.Token{Type: token.STRING, Value: out.String()}
+		case l.ch == '\\':
+			if !l.readEscape(&out) {
+				valid = false
+			}
+		default:
+			// use the bytes from the input so that input that is not valid UTF-8 is kept as is.
+			out.WriteString(l.text(l.position, l.readPosition))
+		}
+	}
+}
+
+/*
+readEscape reads the escape sequence that starts at the \ in l.ch and writes the char it stands for to out.
+It returns with l.ch being the last char of the escape sequence and reports whether the escape sequence was valid.
+It never reads past the end of the line, so that readString can still report a string that is not terminated.
+*/
+func (l *Lexer) readEscape(out *strings.Builder) bool {
+	pos := l.pos()
+	if next := l.peekChar(); next == '\n' || l.readPosition >= l.inputEnd() {
+		return true // the string is not terminated; readString reports that.
+	}
+	l.readChar()
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case '"':
+		out.WriteByte('"')
+	case '\\':
+		out.WriteByte('\\')
+	case 'u':
+		if l.peekChar() != '{' {
+			l.error(pos, l.endPos(), "invalid unicode escape sequence, want \\u{...}")
+			return false
+		}
+		l.readChar()
+		var value rune
+		digits := 0
+		for isHexDigit(l.peekChar()) {
+			l.readChar()
+			if digits < 7 { // more digits than that are invalid anyway; this keeps value from overflowing
+				value = value*16 + hexValue(l.ch)
+			}
+			digits++
+		}
+		if l.peekChar() != '}' || digits == 0 {
+			l.error(pos, l.endPos(), "invalid unicode escape sequence, want \\u{...}")
+			return false
+		}
+		l.readChar()
+		if digits > 6 || !utf8.ValidRune(value) {
+			l.error(pos, l.endPos(), "escape sequence is invalid unicode code point")
+			return false
+		}
+		out.WriteRune(value)
+	case 'x':
+		var value byte
+		for i := 0; i < 2; i++ {
+			if !isHexDigit(l.peekChar()) {
+				l.error(pos, l.endPos(), "invalid byte escape sequence, want \\x and two hex digits")
+				return false
+			}
+			l.readChar()
+			value = value*16 + byte(hexValue(l.ch))
+		}
+		out.WriteByte(value)
+	default:
+		l.error(pos, l.endPos(), "unknown escape sequence \\%c", l.ch)
+		return false
+	}
+	return true
+}
+
+func isHexDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+// hexValue returns the value of the hex digit ch.
+func hexValue(ch rune) rune {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return ch - '0'
+	case 'a' <= ch && ch <= 'f':
+		return ch - 'a' + 10
+	default:
+		return ch - 'A' + 10
 	}
 }
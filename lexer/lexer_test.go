@@ -1,8 +1,14 @@
 package lexer
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
+	"github.com/komuw/cali/internal/testcorpus"
 	"github.com/komuw/cali/token"
 )
 
@@ -103,9 +109,10 @@ func TestNextTokenPage21(t *testing.T) {
 		the input looks like cali source code, with gibberish like !-/*5.
 		That’s okay. The lexer’s job is not to tell us whether code makes sense.
 		The lexer should only turn this input into tokens.
+		There is a space between / and * since /* starts a comment.
 	*/
 	input := `
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5;
 
 	if (5 < 10) {
@@ -175,3 +182,433 @@ func TestNextTokenPage21(t *testing.T) {
 		}
 	}
 }
+
+func TestNextTokenPositions(t *testing.T) {
+	input := "let x = 5;\n\tx == 10;\n"
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedValue string
+		expectedPos   token.Position
+		expectedEnd   token.Position
+	}{
+		{token.LET, "let", token.Position{Filename: "main.cali", Offset: 0, Line: 1, Column: 1}, token.Position{Filename: "main.cali", Offset: 3, Line: 1, Column: 4}},
+		{token.IDENT, "x", token.Position{Filename: "main.cali", Offset: 4, Line: 1, Column: 5}, token.Position{Filename: "main.cali", Offset: 5, Line: 1, Column: 6}},
+		{token.ASSIGN, "=", token.Position{Filename: "main.cali", Offset: 6, Line: 1, Column: 7}, token.Position{Filename: "main.cali", Offset: 7, Line: 1, Column: 8}},
+		{token.INT, "5", token.Position{Filename: "main.cali", Offset: 8, Line: 1, Column: 9}, token.Position{Filename: "main.cali", Offset: 9, Line: 1, Column: 10}},
+		{token.SEMICOLON, ";", token.Position{Filename: "main.cali", Offset: 9, Line: 1, Column: 10}, token.Position{Filename: "main.cali", Offset: 10, Line: 1, Column: 11}},
+		{token.IDENT, "x", token.Position{Filename: "main.cali", Offset: 12, Line: 2, Column: 2}, token.Position{Filename: "main.cali", Offset: 13, Line: 2, Column: 3}},
+		{token.EQ, "==", token.Position{Filename: "main.cali", Offset: 14, Line: 2, Column: 4}, token.Position{Filename: "main.cali", Offset: 16, Line: 2, Column: 6}},
+		{token.INT, "10", token.Position{Filename: "main.cali", Offset: 17, Line: 2, Column: 7}, token.Position{Filename: "main.cali", Offset: 19, Line: 2, Column: 9}},
+		{token.SEMICOLON, ";", token.Position{Filename: "main.cali", Offset: 19, Line: 2, Column: 9}, token.Position{Filename: "main.cali", Offset: 20, Line: 2, Column: 10}},
+		{token.EOF, "", token.Position{Filename: "main.cali", Offset: 21, Line: 3, Column: 1}, token.Position{Filename: "main.cali", Offset: 21, Line: 3, Column: 1}},
+		{token.EOF, "", token.Position{Filename: "main.cali", Offset: 21, Line: 3, Column: 1}, token.Position{Filename: "main.cali", Offset: 21, Line: 3, Column: 1}},
+	}
+	l := NewFileLexer("main.cali", input)
+
+	for _, v := range tests {
+		tok := l.NextToken()
+		if tok.Type != v.expectedType {
+			t.Fatalf("\n Tokentype wrong. \nCalled l.NextToken() \ngot %#+v \nwanted %#+v", tok.Type, v.expectedType)
+		}
+		if tok.Value != v.expectedValue {
+			t.Fatalf("\n Value wrong. \nCalled l.NextToken() \ngot %#+v \nwanted %#+v", tok.Value, v.expectedValue)
+		}
+		if tok.Pos != v.expectedPos {
+			t.Fatalf("\n Pos wrong for %q. \ngot %#+v \nwanted %#+v", tok.Value, tok.Pos, v.expectedPos)
+		}
+		if tok.End != v.expectedEnd {
+			t.Fatalf("\n End wrong for %q. \ngot %#+v \nwanted %#+v", tok.Value, tok.End, v.expectedEnd)
+		}
+	}
+}
+
+func TestNextTokenUnicode(t *testing.T) {
+	input := "let jina = 5;\nlet café_ya_mama = 名前 + नमस्ते;\n\xff é"
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedValue  string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, "let", 1, 1},
+		{token.IDENT, "jina", 1, 5},
+		{token.ASSIGN, "=", 1, 10},
+		{token.INT, "5", 1, 12},
+		{token.SEMICOLON, ";", 1, 13},
+		{token.LET, "let", 2, 1},
+		{token.IDENT, "café_ya_mama", 2, 5},
+		{token.ASSIGN, "=", 2, 18},
+		{token.IDENT, "名前", 2, 20},
+		{token.PLUS, "+", 2, 23},
+		{token.IDENT, "नमस्ते", 2, 25},
+		{token.SEMICOLON, ";", 2, 31},
+		{token.ILLEGAL, "\xff", 3, 1},
+		{token.IDENT, "é", 3, 3},
+		{token.EOF, "", 3, 4},
+	}
+	l := NewLexer(input)
+
+	for _, v := range tests {
+		tok := l.NextToken()
+		if tok.Type != v.expectedType {
+			t.Fatalf("\n Tokentype wrong. \nCalled l.NextToken() \ngot type:%#+v of value:%#+v \nwanted %#+v", tok.Type, tok.Value, v.expectedType)
+		}
+		if tok.Value != v.expectedValue {
+			t.Fatalf("\n Value wrong. \nCalled l.NextToken() \ngot %#+v \nwanted %#+v", tok.Value, v.expectedValue)
+		}
+		if tok.Pos.Line != v.expectedLine || tok.Pos.Column != v.expectedColumn {
+			t.Fatalf("\n Pos wrong for %q. \ngot %d:%d \nwanted %d:%d", tok.Value, tok.Pos.Line, tok.Pos.Column, v.expectedLine, v.expectedColumn)
+		}
+		if tok.Value != input[tok.Pos.Offset:tok.End.Offset] {
+			t.Fatalf("\n Offsets wrong for %q. \ngot %q", tok.Value, input[tok.Pos.Offset:tok.End.Offset])
+		}
+	}
+}
+
+func TestNextTokenStrings(t *testing.T) {
+	input := `"foobar" "foo bar" "" "a\nb\tc" "say \"jambo\"" "back\\slash" "\u{1F600}\u{e9}" "名前" "\x8D\xff\x41" "` + "\x8d" + `";`
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedValue string
+	}{
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.STRING, ""},
+		{token.STRING, "a\nb\tc"},
+		{token.STRING, `say "jambo"`},
+		{token.STRING, `back\slash`},
+		{token.STRING, "😀é"},
+		{token.STRING, "名前"},
+		{token.STRING, "\x8d\xffA"},
+		{token.STRING, "\x8d"}, // input that is not valid UTF-8 is kept as is
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+	l := NewLexer(input)
+
+	for _, v := range tests {
+		tok := l.NextToken()
+		if tok.Type != v.expectedType {
+			t.Fatalf("\n Tokentype wrong. \nCalled l.NextToken() \ngot type:%#+v of value:%#+v \nwanted %#+v", tok.Type, tok.Value, v.expectedType)
+		}
+		if tok.Value != v.expectedValue {
+			t.Fatalf("\n Value wrong. \nCalled l.NextToken() \ngot %#+v \nwanted %#+v", tok.Value, v.expectedValue)
+		}
+	}
+	if len(l.Errors()) != 0 {
+		t.Fatalf("\n unexpected lexer errors: %q", l.Errors())
+	}
+}
+
+func TestNextTokenStringErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue string
+		expectedError string
+	}{
+		{`"foobar`, `"foobar`, "1:1: string literal not terminated"},
+		{"\"foo\nbar\"", `"foo`, "1:1: string literal not terminated"},
+		{`"foo\`, `"foo\`, "1:1: string literal not terminated"},
+		{`"a\qb"`, `"a\qb"`, `1:3: unknown escape sequence \q`},
+		{`"\u1234"`, `"\u1234"`, `1:2: invalid unicode escape sequence, want \u{...}`},
+		{`"\u{}"`, `"\u{}"`, `1:2: invalid unicode escape sequence, want \u{...}`},
+		{`"\u{12"`, `"\u{12"`, `1:2: invalid unicode escape sequence, want \u{...}`},
+		{`"\u{110000}"`, `"\u{110000}"`, `1:2: escape sequence is invalid unicode code point`},
+		{`"\u{D800}"`, `"\u{D800}"`, `1:2: escape sequence is invalid unicode code point`},
+		{`"\x8"`, `"\x8"`, `1:2: invalid byte escape sequence, want \x and two hex digits`},
+		{`"\xg0"`, `"\xg0"`, `1:2: invalid byte escape sequence, want \x and two hex digits`},
+		{`@`, `@`, `1:1: unexpected character '@'`},
+		{"\x00a", "\x00", `1:1: unexpected character '\x00'`},
+	}
+	for _, tt := range tests {
+		l := NewLexer(tt.input)
+		tok := l.NextToken()
+		if tok.Type != token.ILLEGAL {
+			t.Fatalf("\n Tokentype wrong for %q. \ngot type:%#+v of value:%#+v \nwanted %#+v", tt.input, tok.Type, tok.Value, token.ILLEGAL)
+		}
+		if tok.Value != tt.expectedValue {
+			t.Fatalf("\n Value wrong for %q. \ngot %#+v \nwanted %#+v", tt.input, tok.Value, tt.expectedValue)
+		}
+		errors := l.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("\n number of errors mismatch for %q. \ngot %q \nwanted %#+v", tt.input, errors, 1)
+		}
+		if errors[0].Error() != tt.expectedError {
+			t.Errorf("\n wrong error for %q. \ngot %q \nwanted %q", tt.input, errors[0], tt.expectedError)
+		}
+	}
+}
+
+func TestNextTokenNumbers(t *testing.T) {
+	input := "5 1_000 0x2A 0Xff 0o52 0b1010 017 4.2 0.5e3 42e-1 1E+2 1_000.5 5.foo;"
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedValue string
+	}{
+		{token.INT, "5"},
+		{token.INT, "1_000"},
+		{token.INT, "0x2A"},
+		{token.INT, "0Xff"},
+		{token.INT, "0o52"},
+		{token.INT, "0b1010"},
+		{token.INT, "017"},
+		{token.FLOAT, "4.2"},
+		{token.FLOAT, "0.5e3"},
+		{token.FLOAT, "42e-1"},
+		{token.FLOAT, "1E+2"},
+		{token.FLOAT, "1_000.5"},
+		{token.INT, "5"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "foo"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+	l := NewLexer(input)
+
+	for _, v := range tests {
+		tok := l.NextToken()
+		if tok.Type != v.expectedType {
+			t.Fatalf("\n Tokentype wrong. \nCalled l.NextToken() \ngot type:%#+v of value:%#+v \nwanted %#+v", tok.Type, tok.Value, v.expectedType)
+		}
+		if tok.Value != v.expectedValue {
+			t.Fatalf("\n Value wrong. \nCalled l.NextToken() \ngot %#+v \nwanted %#+v", tok.Value, v.expectedValue)
+		}
+	}
+}
+
+func TestNextTokenNumberErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue string
+		expectedError string
+	}{
+		{"0x;", "0x", "1:2: hexadecimal literal has no digits"},
+		{"0b102;", "0b102", "1:5: invalid digit '2' in binary literal"},
+		{"0o78;", "0o78", "1:4: invalid digit '8' in octal literal"},
+		{"1e;", "1e", "1:2: exponent has no digits"},
+		{"1.5e+;", "1.5e+", "1:4: exponent has no digits"},
+	}
+	for _, tt := range tests {
+		l := NewLexer(tt.input)
+		tok := l.NextToken()
+		if tok.Value != tt.expectedValue {
+			t.Fatalf("\n Value wrong for %q. \ngot %#+v \nwanted %#+v", tt.input, tok.Value, tt.expectedValue)
+		}
+		for tok.Type != token.EOF {
+			tok = l.NextToken()
+		}
+		errors := l.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("\n number of errors mismatch for %q. \ngot %q \nwanted %#+v", tt.input, errors, 1)
+		}
+		if errors[0].Error() != tt.expectedError {
+			t.Errorf("\n wrong error for %q. \ngot %q \nwanted %q", tt.input, errors[0], tt.expectedError)
+		}
+	}
+}
+
+func TestNextTokenComments(t *testing.T) {
+	input := `// a line comment
+let x = 5; // trailing comment
+/* a block
+   comment */ let y = x / 2;
+/* nested /* block */ comment */
+x;//`
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedValue string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.LET, "let"},
+		{token.IDENT, "y"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+	l := NewLexer(input)
+
+	for _, v := range tests {
+		tok := l.NextToken()
+		if tok.Type != v.expectedType {
+			t.Fatalf("\n Tokentype wrong. \nCalled l.NextToken() \ngot type:%#+v of value:%#+v \nwanted %#+v", tok.Type, tok.Value, v.expectedType)
+		}
+		if tok.Value != v.expectedValue {
+			t.Fatalf("\n Value wrong. \nCalled l.NextToken() \ngot %#+v \nwanted %#+v", tok.Value, v.expectedValue)
+		}
+	}
+}
+
+func TestNextTokenKeepComments(t *testing.T) {
+	input := "// a line comment\r\nlet x = 5; /* a /* nested */ block */\n//"
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedValue string
+		expectedLine  int
+	}{
+		{token.COMMENT, "// a line comment", 1},
+		{token.LET, "let", 2},
+		{token.IDENT, "x", 2},
+		{token.ASSIGN, "=", 2},
+		{token.INT, "5", 2},
+		{token.SEMICOLON, ";", 2},
+		{token.COMMENT, "/* a /* nested */ block */", 2},
+		{token.COMMENT, "//", 3},
+		{token.EOF, "", 3},
+	}
+	l := NewLexer(input)
+	l.KeepComments = true
+
+	for _, v := range tests {
+		tok := l.NextToken()
+		if tok.Type != v.expectedType {
+			t.Fatalf("\n Tokentype wrong. \nCalled l.NextToken() \ngot type:%#+v of value:%#+v \nwanted %#+v", tok.Type, tok.Value, v.expectedType)
+		}
+		if tok.Value != v.expectedValue {
+			t.Fatalf("\n Value wrong. \nCalled l.NextToken() \ngot %#+v \nwanted %#+v", tok.Value, v.expectedValue)
+		}
+		if tok.Pos.Line != v.expectedLine {
+			t.Fatalf("\n Line wrong for %q. \ngot %#+v \nwanted %#+v", tok.Value, tok.Pos.Line, v.expectedLine)
+		}
+	}
+}
+
+func TestNextTokenUnterminatedComment(t *testing.T) {
+	inputs := []string{
+		"let x = 5; /* not terminated",
+		"let x = 5; /* /* nested */ but not terminated",
+		"let x = 5; /*/",
+	}
+	for _, input := range inputs {
+		l := NewLexer(input)
+		var tok token.Token
+		for tok = l.NextToken(); tok.Type != token.ILLEGAL && tok.Type != token.EOF; tok = l.NextToken() {
+		}
+		if tok.Type != token.ILLEGAL {
+			t.Fatalf("\n Tokentype wrong for %q. \ngot type:%#+v \nwanted %#+v", input, tok.Type, token.ILLEGAL)
+		}
+		if tok.Value != input[11:] {
+			t.Fatalf("\n Value wrong for %q. \ngot %#+v \nwanted %#+v", input, tok.Value, input[11:])
+		}
+		errors := l.Errors()
+		if len(errors) != 1 || errors[0].Error() != "1:12: comment not terminated" {
+			t.Fatalf("\n wrong errors for %q. \ngot %q", input, errors)
+		}
+		if tok = l.NextToken(); tok.Type != token.EOF {
+			t.Fatalf("\n Tokentype wrong for %q. \ngot type:%#+v \nwanted %#+v", input, tok.Type, token.EOF)
+		}
+	}
+}
+
+func BenchmarkNextToken(b *testing.B) {
+	b.SetBytes(int64(len(testcorpus.Benchmark)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l := NewLexer(testcorpus.Benchmark)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+	}
+}
+
+func TestReaderLexer(t *testing.T) {
+	tests := []string{
+		`let add = fn(x, y) { x + y; };`,
+		"let s = \"jambo 名前 \\u{1F600}\"; /* a /* nested */ comment */ let z = 0x2A * 4.2e1;\n// the end",
+		"let x = 5 @ \xff \"not terminated",
+		"let café = \"😀\";\nlet नमस्ते = 1;",
+		testcorpus.Benchmark,
+	}
+	for _, input := range tests {
+		l := NewFileLexer("main.cali", input)
+		l.KeepComments = true
+		// a reader that returns one byte at a time, so that every char is split across reads.
+		rl := NewReaderLexer("main.cali", iotest.OneByteReader(strings.NewReader(input)))
+		rl.KeepComments = true
+		for {
+			expected, got := l.NextToken(), rl.NextToken()
+			if got != expected {
+				t.Fatalf("\n token wrong. \ngot %#+v \nwanted %#+v", got, expected)
+			}
+			if got.Type == token.EOF {
+				break
+			}
+		}
+		if fmt.Sprint(rl.Errors()) != fmt.Sprint(l.Errors()) {
+			t.Errorf("\n errors mismatch. \ngot %q \nwanted %q", rl.Errors(), l.Errors())
+		}
+	}
+}
+
+func TestReaderLexerBoundedBuffer(t *testing.T) {
+	l := NewReaderLexer("", strings.NewReader(testcorpus.Benchmark))
+	maxLen := 0
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if cap(l.window) > maxLen {
+			maxLen = cap(l.window)
+		}
+	}
+	if maxLen > 2*readerBufferSize {
+		t.Errorf("\n lexer held on to too much input. \ngot %d bytes \nwanted at most %d", maxLen, 2*readerBufferSize)
+	}
+}
+
+// a token that is much bigger than what is read at a time grows the window, but only to about twice its size.
+func TestReaderLexerLargeToken(t *testing.T) {
+	comment := "/*" + strings.Repeat("x", 4<<20) + "*/"
+	l := NewReaderLexer("", strings.NewReader(comment+" 1;"))
+	l.KeepComments = true
+	tok := l.NextToken()
+	if tok.Type != token.COMMENT || tok.Value != comment {
+		t.Fatalf("\n wrong token. \ngot %s of %d bytes \nwanted %s of %d bytes", tok.Type, len(tok.Value), token.COMMENT, len(comment))
+	}
+	if max := 2*len(comment) + 2*readerBufferSize; cap(l.window) > max {
+		t.Errorf("\n lexer held on to too much input. \ngot %d bytes \nwanted at most %d", cap(l.window), max)
+	}
+	if tok := l.NextToken(); tok.Type != token.INT || tok.Pos.Offset != len(comment)+1 {
+		t.Errorf("\n wrong token after the comment. \ngot %#+v", tok)
+	}
+}
+
+// lexing a big token takes time in proportion to its size; see fill.
+func BenchmarkReaderLexerLargeToken(b *testing.B) {
+	comment := "/*" + strings.Repeat("x", 16<<20) + "*/"
+	b.SetBytes(int64(len(comment)))
+	for i := 0; i < b.N; i++ {
+		l := NewReaderLexer("", strings.NewReader(comment))
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+	}
+}
+
+func TestReaderLexerReadError(t *testing.T) {
+	errRead := errors.New("disk on fire")
+	l := NewReaderLexer("main.cali", io.MultiReader(strings.NewReader("let x\n= 5;"), iotest.ErrReader(errRead)))
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON, token.ILLEGAL, token.EOF, token.EOF}
+	for _, v := range expected {
+		tok := l.NextToken()
+		if tok.Type != v {
+			t.Fatalf("\n Tokentype wrong. \ngot type:%#+v of value:%#+v \nwanted %#+v", tok.Type, tok.Value, v)
+		}
+	}
+	errs := l.Errors()
+	if len(errs) != 1 {
+		t.Fatalf("\n number of errors mismatch. \ngot %q \nwanted %#+v", errs, 1)
+	}
+	if errs[0].Error() != "main.cali:2:5: could not read input: disk on fire" {
+		t.Errorf("\n wrong error. \ngot %q", errs[0])
+	}
+	if err := l.ReadError(); err != errRead {
+		t.Errorf("\n wrong read error. \ngot %v \nwanted %v", err, errRead)
+	}
+	if err := NewReaderLexer("", strings.NewReader("let x = 5;")).ReadError(); err != nil {
+		t.Errorf("\n read error for a reader that did not fail: %v", err)
+	}
+}
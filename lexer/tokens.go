@@ -0,0 +1,156 @@
+package lexer
+
+import (
+	"context"
+
+	"github.com/komuw/cali/token"
+)
+
+/*
+CONCURRENT LEXING
+
+This borrows from the design in the talk; Lexical Scanning in Go by Rob Pike.
+The lexer runs in its own goroutine and sends the tokens it finds over a channel, the parser receives them
+in another goroutine. So the parser can start working on the first tokens while the rest of the input is still being lexed.
+
+Like in the talk, the lexer goroutine is a state machine. Each state is a function(a stateFn) that lexes what it knows
+about, sends the tokens it found and returns the next state; lexText looks at the next char to pick the state for it,
+lexNumber lexes a number and goes back to lexText, and so on. A nil state stops the machine;
+
+	for state := lexText; state != nil; {
+		state = state(e)
+	}
+
+The states use the same read funcs(readNumber, readString...) as NextToken, so both produce the same tokens.
+*/
+
+// tokensBufferSize is the capacity of the channel returned by Tokens. It lets the lexer run ahead of the parser a little.
+const tokensBufferSize = 128
+
+/*
+Tokens lexes the input in a new goroutine and returns a channel over which the tokens are sent, in order.
+The last token sent is the token.EOF token, after which the channel is closed.
+
+Cancelling ctx stops the lexer; the channel is then closed without a token.EOF token being sent.
+So a receiver can tell that the input was cut short.
+The goroutine only stops at the end of the input or when ctx is cancelled. A receiver that stops receiving before the
+token.EOF token has to cancel ctx, otherwise the goroutine is blocked forever on sending the next token.
+
+Once Tokens has been called, NextToken must not be called. Errors can still be called, from any goroutine.
+*/
+func (l *Lexer) Tokens(ctx context.Context) <-chan token.Token {
+	out := make(chan token.Token, tokensBufferSize)
+	e := &emitter{l: l, ctx: ctx, out: out}
+	go func() {
+		defer close(out)
+		for state := lexText; state != nil; {
+			state = state(e)
+		}
+	}()
+	return out
+}
+
+// emitter is what the states of the lexer goroutine work with; the lexer, and where to send the tokens to.
+type emitter struct {
+	l   *Lexer
+	ctx context.Context
+	out chan<- token.Token
+}
+
+// stateFn is a state of the lexer goroutine; it returns the next state, or nil to stop.
+type stateFn func(e *emitter) stateFn
+
+/*
+emit sends tok. It returns false if ctx was cancelled instead; the states then stop.
+ctx is checked before sending, since a select picks at random when both of its cases are ready; without the check the
+lexer could go on sending tokens, to a receiver that keeps receiving, after ctx was cancelled.
+*/
+func (e *emitter) emit(tok token.Token) bool {
+	if e.ctx.Err() != nil {
+		return false
+	}
+	select {
+	case e.out <- tok:
+		return true
+	case <-e.ctx.Done():
+		return false
+	}
+}
+
+/*
+read calls f to read the token that starts at the current char, and sets the token's positions like NextToken does.
+f is called with l.ch being the first char of the token and returns with it being the char after the token.
+*/
+func (e *emitter) read(f func(l *Lexer) token.Token) token.Token {
+	l := e.l
+	l.mark = l.position
+	pos := l.pos()
+	tok := f(l)
+	tok.Pos, tok.End = pos, l.pos()
+	return tok
+}
+
+// next emits tok, and returns state as the next state; or nil if ctx was cancelled.
+func (e *emitter) next(tok token.Token, state stateFn) stateFn {
+	if !e.emit(tok) {
+		return nil
+	}
+	return state
+}
+
+// lexText skips whitespace, and picks the state for what comes after it by looking at the char it starts with.
+func lexText(e *emitter) stateFn {
+	l := e.l
+	l.skipWhitespace()
+	switch {
+	case l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*'):
+		return lexComment
+	case l.ch == '"':
+		return lexString
+	case isLetter(l.ch):
+		return lexIdentifier
+	case isDigit(l.ch):
+		return lexNumber
+	default:
+		return lexOperator
+	}
+}
+
+// lexComment reads a comment. Only comments that were asked for(see KeepComments) and unterminated ones are sent.
+func lexComment(e *emitter) stateFn {
+	tok := e.read((*Lexer).readComment)
+	if tok.Type == token.ILLEGAL || e.l.KeepComments {
+		return e.next(tok, lexText)
+	}
+	return lexText
+}
+
+func lexString(e *emitter) stateFn {
+	return e.next(e.read((*Lexer).readString), lexText)
+}
+
+func lexIdentifier(e *emitter) stateFn {
+	tok := e.read(func(l *Lexer) token.Token {
+		value := l.readIdentifier()
+		return token.Token{Type: token.LookupIdent(value), Value: value}
+	})
+	return e.next(tok, lexText)
+}
+
+func lexNumber(e *emitter) stateFn {
+	return e.next(e.read((*Lexer).readNumber), lexText)
+}
+
+/*
+lexOperator lexes everything that lexText has no state of its own for; operators, delimiters, chars that are not
+allowed and the end of the input. Those are single tokens that NextToken already knows how to lex, so it uses that.
+The token.EOF token is the last one; the machine stops after sending it.
+*/
+func lexOperator(e *emitter) stateFn {
+	tok := e.l.NextToken()
+	if tok.Type == token.EOF {
+		e.emit(tok)
+		return nil
+	}
+	return e.next(tok, lexText)
+}
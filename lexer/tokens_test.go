@@ -0,0 +1,91 @@
+package lexer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/komuw/cali/internal/testcorpus"
+	"github.com/komuw/cali/token"
+)
+
+// the states of the lexer goroutine produce the same tokens and errors as NextToken, for every kind of token.
+func TestTokens(t *testing.T) {
+	errRead := errors.New("disk on fire")
+	tests := []struct {
+		name         string
+		newLexer     func() *Lexer
+		keepComments bool
+	}{
+		{"code", func() *Lexer {
+			return NewLexer(`let add = fn(x, y) { x + y; };
+let s = "jambo\q"; // a comment
+let result = add(0x2A, 4.2) @ 5 != 1e; /* a /* nested */ comment */ 0b102 == !true;`)
+		}, false},
+		{"comments", func() *Lexer { return NewLexer("// one\nx /* two */ / y; /* not terminated") }, true},
+		{"unterminated comment", func() *Lexer { return NewLexer("x; /* not terminated") }, false},
+		{"illegal chars", func() *Lexer { return NewLexer("x\x00y \xff 名前;") }, false},
+		{"benchmark", func() *Lexer { return NewLexer(testcorpus.Benchmark) }, false},
+		{"read error", func() *Lexer {
+			return NewReaderLexer("main.cali", io.MultiReader(strings.NewReader("let x\n= 5;"), iotest.ErrReader(errRead)))
+		}, false},
+	}
+	for _, tt := range tests {
+		l := tt.newLexer()
+		l.KeepComments = tt.keepComments
+		expected := []token.Token{}
+		for {
+			tok := l.NextToken()
+			expected = append(expected, tok)
+			if tok.Type == token.EOF {
+				break
+			}
+		}
+		expectedErrors := l.Errors()
+
+		l = tt.newLexer()
+		l.KeepComments = tt.keepComments
+		got := []token.Token{}
+		for tok := range l.Tokens(context.Background()) {
+			got = append(got, tok)
+		}
+		if len(got) != len(expected) {
+			t.Fatalf("\n number of tokens mismatch for %s. \ngot %d \nwanted %d", tt.name, len(got), len(expected))
+		}
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Fatalf("\n token %d wrong for %s. \ngot %#+v \nwanted %#+v", i, tt.name, got[i], expected[i])
+			}
+		}
+		if !reflect.DeepEqual(l.Errors(), expectedErrors) {
+			t.Errorf("\n wrong errors for %s. \ngot %q \nwanted %q", tt.name, l.Errors(), expectedErrors)
+		}
+	}
+}
+
+func TestTokensCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := NewLexer(testcorpus.Benchmark)
+	tokens := l.Tokens(ctx)
+	<-tokens
+	cancel()
+
+	n := 0
+	for tok := range tokens {
+		if tok.Type == token.EOF {
+			t.Fatalf("\n lexer was not stopped; got %s after %d tokens", tok.Type, n)
+		}
+		n++
+	}
+	/*
+		the lexer checks ctx before it sends a token. So it can only have been ahead of us by the channel's buffer, plus
+		the token it was waiting to send when ctx was cancelled.
+	*/
+	if n > tokensBufferSize+1 {
+		t.Errorf("\n lexer was not stopped. \ngot %d tokens after cancel", n)
+	}
+}
@@ -1,14 +1,80 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strings"
 
+	"github.com/komuw/cali/ast"
+	"github.com/komuw/cali/cache"
+	"github.com/komuw/cali/eval"
+	"github.com/komuw/cali/format"
+	"github.com/komuw/cali/lexer"
+	"github.com/komuw/cali/object"
+	"github.com/komuw/cali/parser"
 	"github.com/komuw/cali/repl"
 )
 
+/*
+Usage;
+
+	cali                         starts the REPL
+	cali script.cali             runs script.cali
+	cali ast [--json] file.cali  prints the AST of file.cali; as JSON on one line(see ast.Program.MarshalJSON) with --json
+	cali fmt [-w] [-d] [files]   formats files(or stdin) in the canonical style; see package format
+
+When running a script, the exit status tells what happened, so that cali can be used in build scripts and cron jobs;
+
+	0  the script ran successfully
+	1  the script failed while being evaluated(a runtime error). For cali fmt -d; a file is not formatted
+	2  the script could not be parsed
+	3  the script could not be read(eg it does not exist, or permission is denied). For cali fmt -w; a file could not be written
+	4  cali was called with the wrong arguments
+
+A script called ast or fmt has to be run as ./ast or ./fmt, since cali ast and cali fmt are subcommands.
+Likewise a script whose name starts with a -, since those are taken as flags; cali -h prints the usage.
+cali does not pass args on to scripts yet, so args after the script are an error rather than being dropped.
+
+If the environment variable CALI_CACHE_DIR is set, the ASTs of scripts are cached in that directory.
+Running a script that has not changed since its last run then skips parsing; see package cache.
+*/
+const (
+	exitOK           = 0
+	exitRuntimeError = 1
+	exitParseError   = 2
+	exitIOError      = 3
+	exitUsageError   = 4
+
+	exitNotFormatted = 1 // only used by cali fmt -d; which is meant to be run by pre-commit hooks and CI
+)
+
+// usage is printed when cali is called with the wrong arguments.
+const usage = `usage:
+	cali                         starts the REPL
+	cali script.cali             runs script.cali
+	cali ast [--json] file.cali  prints the AST of file.cali
+	cali fmt [-w] [-d] [files]   formats files(or stdin) in the canonical style
+`
+
+// cacheDirEnv is the environment variable that turns on the AST cache.
+const cacheDirEnv = "CALI_CACHE_DIR"
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "ast":
+			os.Exit(astCommand(os.Args[2:], os.Stdout, os.Stderr))
+		case "fmt":
+			os.Exit(fmtCommand(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		}
+		os.Exit(runCommand(os.Args[1:], os.Stderr))
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -17,3 +83,268 @@ func main() {
 	fmt.Printf("You can type in commands\n")
 	repl.Start(os.Stdin, os.Stdout)
 }
+
+/*
+runCommand implements; cali script.cali
+args are the arguments to cali; there is at least one. Errors are written to errOut. It returns the exit status for the process.
+*/
+func runCommand(args []string, errOut io.Writer) int {
+	if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprint(errOut, usage)
+		return exitUsageError
+	}
+	return runFile(args[0], errOut)
+}
+
+/*
+runFile lexes, parses and evaluates the file at filename.
+Errors are written to errOut. It returns the exit status for the process.
+*/
+func runFile(filename string, errOut io.Writer) int {
+	var program *ast.Program
+	var errs parser.ErrorList
+	var err error
+	if dir := os.Getenv(cacheDirEnv); dir != "" {
+		program, errs, err = parseCached(filename, dir)
+	} else {
+		program, errs, err = parseFile(filename)
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "cali: %v\n", err)
+		return exitIOError
+	}
+	if len(errs) != 0 {
+		printParseErrors(filename, errs, errOut)
+		return exitParseError
+	}
+
+	env := object.NewEnvironment()
+	result := eval.Eval(program, env)
+	if errObj, ok := result.(*object.Error); ok {
+		fmt.Fprintln(errOut, errObj.Inspect())
+		return exitRuntimeError
+	}
+	return exitOK
+}
+
+/*
+astCommand implements; cali ast [--json] file.cali
+It writes the AST to out and errors to errOut. It returns the exit status for the process.
+*/
+func astCommand(args []string, out, errOut io.Writer) int {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	asJSON := flags.Bool("json", false, "print the AST as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(errOut, "usage: cali ast [--json] file.cali")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsageError
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsageError
+	}
+
+	filename := flags.Arg(0)
+	program, errs, err := parseFile(filename)
+	if err != nil {
+		fmt.Fprintf(errOut, "cali: %v\n", err)
+		return exitIOError
+	}
+	if len(errs) != 0 {
+		printParseErrors(filename, errs, errOut)
+		return exitParseError
+	}
+
+	if !*asJSON {
+		fmt.Fprintln(out, program.String())
+		return exitOK
+	}
+	/*
+		the JSON is written as MarshalJSON makes it; on one line. Indented, it would grow with the depth of the AST.
+		Tools do not need it, and people can pipe the output through a JSON formatter like jq.
+		A program nested more than ast.MaxDepth nodes deep can not be encoded; that is reported as an error.
+	*/
+	data, err := program.MarshalJSON()
+	if err != nil {
+		fmt.Fprintf(errOut, "cali: %v\n", err)
+		return exitRuntimeError
+	}
+	out.Write(append(data, '\n'))
+	return exitOK
+}
+
+/*
+fmtCommand implements; cali fmt [-w] [-d] [file.cali...]
+Like gofmt, it writes the formatted files to out; unless -w or -d is given. Without files it formats in.
+
+	-w  writes the formatted code back to the files that are not formatted, instead of to out.
+	-d  writes the diff between each file and its formatted code to out, and exits with exitNotFormatted if there is any.
+
+Errors are written to errOut. A file with errors is left alone and the other files are still formatted.
+*/
+func fmtCommand(args []string, in io.Reader, out, errOut io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	write := flags.Bool("w", false, "write the result to the file instead of to stdout")
+	diff := flags.Bool("d", false, "print diffs instead of the formatted code")
+	flags.Usage = func() {
+		fmt.Fprintln(errOut, "usage: cali fmt [-w] [-d] [file.cali...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsageError
+	}
+	if flags.NArg() == 0 && *write {
+		fmt.Fprintln(errOut, "cali: can not use -w with stdin")
+		return exitUsageError
+	}
+
+	status := exitOK
+	formatFile := func(filename string, src []byte) {
+		formatted, err := format.Source(filename, src)
+		if err != nil {
+			if errs, ok := err.(parser.ErrorList); ok {
+				for _, e := range errs {
+					fmt.Fprintln(errOut, e.Snippet(string(src)))
+				}
+			} else {
+				fmt.Fprintf(errOut, "cali: %v\n", err)
+			}
+			status = exitParseError
+			return
+		}
+		if *diff {
+			if d := unifiedDiff(filename+".orig", filename, src, formatted); d != nil {
+				out.Write(d)
+				if status == exitOK {
+					status = exitNotFormatted
+				}
+			}
+		}
+		if *write {
+			if bytes.Equal(src, formatted) {
+				return
+			}
+			if err := replaceFile(filename, formatted); err != nil {
+				fmt.Fprintf(errOut, "cali: %v\n", err)
+				status = exitIOError
+			}
+			return
+		}
+		if !*diff {
+			out.Write(formatted)
+		}
+	}
+
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(in)
+		if err != nil {
+			fmt.Fprintf(errOut, "cali: %v\n", err)
+			return exitIOError
+		}
+		formatFile("<standard input>", src)
+		return status
+	}
+	for _, filename := range flags.Args() {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintf(errOut, "cali: %v\n", err)
+			status = exitIOError
+			continue
+		}
+		formatFile(filename, src)
+	}
+	return status
+}
+
+/*
+replaceFile replaces the contents of the file at filename with data, and keeps its permissions.
+data is written to a temporary file next to it, which is then renamed to filename; like package cache does.
+So if writing fails(eg the disk is full), the file is left as it was instead of being cut short.
+If filename is a symlink, the file it links to is replaced and the symlink is kept.
+*/
+func replaceFile(filename string, data []byte) error {
+	filename, err := filepath.EvalSymlinks(filename)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(info.Mode().Perm())
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// printParseErrors writes errs to errOut. It reads the file at filename again, to show the offending lines.
+func printParseErrors(filename string, errs parser.ErrorList, errOut io.Writer) {
+	src, err := os.ReadFile(filename)
+	for _, e := range errs {
+		if err != nil {
+			fmt.Fprintln(errOut, e)
+			continue
+		}
+		fmt.Fprintln(errOut, e.Snippet(string(src)))
+	}
+}
+
+/*
+parseFile parses the file at filename.
+The file is streamed to the lexer instead of being read whole, so that big scripts do not have to fit in memory twice.
+The error is for a file that can not be read; problems in the source code are in the ErrorList.
+*/
+func parseFile(filename string) (*ast.Program, parser.ErrorList, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	l := lexer.NewReaderLexer(filename, f)
+	p := parser.NewParser(l)
+	program := p.ParseProgram()
+	// a file that fails while it is read(eg it is a directory) can not be read, rather than not be parsed.
+	if err := l.ReadError(); err != nil {
+		return nil, nil, err
+	}
+	return program, p.Errors(), nil
+}
+
+/*
+parseCached is parseFile, but it gets the program from the AST cache in dir if the file has been parsed before.
+The file has to be read whole, since the cache key is the hash of its contents.
+If the cache can not be used(eg dir can not be created), the file is parsed as usual.
+*/
+func parseCached(filename, dir string) (*ast.Program, parser.ErrorList, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := cache.New(1, dir)
+	if err != nil {
+		p := parser.NewParser(lexer.NewFileLexer(filename, string(src)))
+		program := p.ParseProgram()
+		return program, p.Errors(), nil
+	}
+	program, errs := c.Parse(filename, src)
+	return program, errs, nil
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/komuw/cali/ast"
+)
+
+func TestRunFile(t *testing.T) {
+	tests := []struct {
+		src            string
+		expectedStatus int
+		expectedOutput string
+	}{
+		{"let add = fn(x, y) { x + y; };\nadd(1, 2);\n", exitOK, ""},
+		{"let x = 5;\nlet = 10;\n", exitParseError, "script.cali:2:5: expected next token to be IDENT, got = instead\nlet = 10;\n    ^\n"},
+		{"let x = 5;\nx + y;\n", exitRuntimeError, "ERROR: script.cali:2:5: identifier not found: y\n"},
+	}
+	for _, tt := range tests {
+		filename := filepath.Join(t.TempDir(), "script.cali")
+		if err := os.WriteFile(filename, []byte(tt.src), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var errOut bytes.Buffer
+		status := runFile(filename, &errOut)
+		if status != tt.expectedStatus {
+			t.Errorf("\n wrong exit status for %q. \ngot %#+v \nwanted %#+v", tt.src, status, tt.expectedStatus)
+		}
+		output := strings.Replace(errOut.String(), filename, "script.cali", -1)
+		if output != tt.expectedOutput {
+			t.Errorf("\n wrong output for %q. \ngot %q \nwanted %q", tt.src, output, tt.expectedOutput)
+		}
+	}
+}
+
+func TestRunCommandUsage(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "script.cali")
+	if err := os.WriteFile(filename, []byte("1;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := [][]string{
+		{"-h"},
+		{"--help"},
+		{"-x", filename},
+		{filename, "extra"},
+	}
+	for _, args := range tests {
+		var errOut bytes.Buffer
+		if status := runCommand(args, &errOut); status != exitUsageError {
+			t.Errorf("\n wrong exit status for %q. \ngot %#+v \nwanted %#+v", args, status, exitUsageError)
+		}
+		if !strings.HasPrefix(errOut.String(), "usage:") {
+			t.Errorf("\n no usage for %q. \ngot %q", args, errOut.String())
+		}
+	}
+
+	var errOut bytes.Buffer
+	if status := runCommand([]string{filename}, &errOut); status != exitOK {
+		t.Errorf("\n wrong exit status. \ngot %#+v \nwanted %#+v \nerrOut %q", status, exitOK, errOut.String())
+	}
+}
+
+func TestRunFileIOErrors(t *testing.T) {
+	dir := t.TempDir()
+	unreadable := filepath.Join(dir, "unreadable.cali")
+	if err := os.WriteFile(unreadable, []byte("let x = 5;\n"), 0200); err != nil {
+		t.Fatal(err)
+	}
+	filenames := []string{
+		filepath.Join(dir, "missing.cali"),
+		dir, // it can be opened, but reading it fails
+	}
+	// root can read the file anyway.
+	if f, err := os.Open(unreadable); err == nil {
+		f.Close()
+	} else {
+		filenames = append(filenames, unreadable)
+	}
+
+	for _, cacheDir := range []string{"", filepath.Join(dir, "cache")} {
+		t.Setenv(cacheDirEnv, cacheDir)
+		for _, filename := range filenames {
+			var errOut bytes.Buffer
+			status := runFile(filename, &errOut)
+			if status != exitIOError {
+				t.Errorf("\n wrong exit status for %q. \ngot %#+v \nwanted %#+v \nerrOut %q", filename, status, exitIOError, errOut.String())
+			}
+			if !strings.HasPrefix(errOut.String(), "cali: ") {
+				t.Errorf("\n wrong output for %q. \ngot %q", filename, errOut.String())
+			}
+		}
+	}
+}
+
+func TestRunFileCached(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	t.Setenv(cacheDirEnv, cacheDir)
+
+	filename := filepath.Join(dir, "script.cali")
+	if err := os.WriteFile(filename, []byte("let x = 5;\nx + y;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		var errOut bytes.Buffer
+		status := runFile(filename, &errOut)
+		if status != exitRuntimeError {
+			t.Errorf("\n wrong exit status for run %d. \ngot %#+v \nwanted %#+v", i, status, exitRuntimeError)
+		}
+		expected := "ERROR: " + filename + ":2:5: identifier not found: y\n"
+		if errOut.String() != expected {
+			t.Errorf("\n wrong output for run %d. \ngot %q \nwanted %q", i, errOut.String(), expected)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(cacheDir, "*.ast"))
+	if len(files) != 1 {
+		t.Errorf("\n wrong number of cached files. \ngot %q \nwanted %d", files, 1)
+	}
+}
+
+func TestASTCommand(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "script.cali")
+	if err := os.WriteFile(filename, []byte("let x = 5 * 2;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	status := astCommand([]string{filename}, &out, &errOut)
+	if status != exitOK {
+		t.Fatalf("\n wrong exit status. \ngot %#+v \nwanted %#+v \nerrors %q", status, exitOK, errOut.String())
+	}
+	if out.String() != "let x = (5 * 2);\n" {
+		t.Errorf("\n wrong output. \ngot %q", out.String())
+	}
+
+	out.Reset()
+	status = astCommand([]string{"--json", filename}, &out, &errOut)
+	if status != exitOK {
+		t.Fatalf("\n wrong exit status. \ngot %#+v \nwanted %#+v \nerrors %q", status, exitOK, errOut.String())
+	}
+	program := &ast.Program{}
+	if err := json.Unmarshal(out.Bytes(), program); err != nil {
+		t.Fatalf("\n output is not the JSON of a program: %v \n%s", err, out.String())
+	}
+	if program.String() != "let x = (5 * 2);" {
+		t.Errorf("\n wrong program. \ngot %q", program.String())
+	}
+}
+
+func TestASTCommandErrors(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "script.cali")
+	if err := os.WriteFile(filename, []byte("let = 5;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args           []string
+		expectedStatus int
+	}{
+		{[]string{}, exitUsageError},
+		{[]string{"--yaml", filename}, exitUsageError},
+		{[]string{"a.cali", "b.cali"}, exitUsageError},
+		{[]string{filepath.Join(dir, "missing.cali")}, exitIOError},
+		{[]string{dir}, exitIOError},
+		{[]string{"--json", filename}, exitParseError},
+	}
+	for _, tt := range tests {
+		var out, errOut bytes.Buffer
+		status := astCommand(tt.args, &out, &errOut)
+		if status != tt.expectedStatus {
+			t.Errorf("\n wrong exit status for %q. \ngot %#+v \nwanted %#+v", tt.args, status, tt.expectedStatus)
+		}
+		if out.Len() != 0 || errOut.Len() == 0 {
+			t.Errorf("\n wrong output for %q. \nout %q \nerrOut %q", tt.args, out.String(), errOut.String())
+		}
+	}
+}
+
+func TestFmtCommand(t *testing.T) {
+	const (
+		src       = "let add=fn(x,y){x+y;};\nadd(1,2);\n"
+		formatted = "let add = fn(x, y) {\n\tx + y;\n};\nadd(1, 2);\n"
+	)
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "script.cali")
+	if err := os.WriteFile(filename, []byte(src), 0640); err != nil {
+		t.Fatal(err)
+	}
+	// -w writes through symlinks.
+	link := filepath.Join(dir, "link.cali")
+	if err := os.Symlink("script.cali", link); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	if status := fmtCommand([]string{filename}, nil, &out, &errOut); status != exitOK {
+		t.Fatalf("\n wrong exit status. \ngot %#+v \nwanted %#+v \nerrOut %q", status, exitOK, errOut.String())
+	}
+	if out.String() != formatted {
+		t.Errorf("\n wrong output. \ngot %q \nwanted %q", out.String(), formatted)
+	}
+
+	out.Reset()
+	if status := fmtCommand([]string{"-d", filename}, nil, &out, &errOut); status != exitNotFormatted {
+		t.Errorf("\n wrong exit status for -d. \ngot %#+v \nwanted %#+v", status, exitNotFormatted)
+	}
+	expectedDiff := "--- " + filename + ".orig\n+++ " + filename + "\n" +
+		"@@ -1,2 +1,4 @@\n" +
+		"-let add=fn(x,y){x+y;};\n-add(1,2);\n" +
+		"+let add = fn(x, y) {\n+\tx + y;\n+};\n+add(1, 2);\n"
+	if out.String() != expectedDiff {
+		t.Errorf("\n wrong diff. \ngot %q \nwanted %q", out.String(), expectedDiff)
+	}
+
+	out.Reset()
+	if status := fmtCommand([]string{"-w", link}, nil, &out, &errOut); status != exitOK || out.Len() != 0 {
+		t.Errorf("\n wrong result for -w. \nstatus %#+v \nout %q \nerrOut %q", status, out.String(), errOut.String())
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != formatted {
+		t.Errorf("\n file not formatted. \ngot %q \nwanted %q", data, formatted)
+	}
+	if info, err := os.Stat(filename); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("\n -w changed the permissions of the file. \ngot %v \nwanted %v", info.Mode(), os.FileMode(0640))
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("\n -w replaced the symlink %s", link)
+	}
+	// the temporary file that the formatted code was written to is gone.
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 2 {
+		t.Errorf("\n wrong files left in %s: %v", dir, entries)
+	}
+	// a formatted file has no diff.
+	if status := fmtCommand([]string{"-d", filename}, nil, &out, &errOut); status != exitOK || out.Len() != 0 {
+		t.Errorf("\n wrong result for -d of a formatted file. \nstatus %#+v \nout %q", status, out.String())
+	}
+
+	// without files, stdin is formatted.
+	out.Reset()
+	if status := fmtCommand(nil, strings.NewReader(src), &out, &errOut); status != exitOK || out.String() != formatted {
+		t.Errorf("\n wrong result for stdin. \nstatus %#+v \nout %q", status, out.String())
+	}
+}
+
+func TestFmtCommandErrors(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "script.cali")
+	if err := os.WriteFile(filename, []byte("let = 5;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args           []string
+		expectedStatus int
+	}{
+		{[]string{"-w"}, exitUsageError},
+		{[]string{"--yaml", filename}, exitUsageError},
+		{[]string{filepath.Join(dir, "missing.cali")}, exitIOError},
+		{[]string{dir}, exitIOError},
+		{[]string{"-w", filename}, exitParseError},
+	}
+	for _, tt := range tests {
+		var out, errOut bytes.Buffer
+		status := fmtCommand(tt.args, strings.NewReader(""), &out, &errOut)
+		if status != tt.expectedStatus {
+			t.Errorf("\n wrong exit status for %q. \ngot %#+v \nwanted %#+v", tt.args, status, tt.expectedStatus)
+		}
+		if out.Len() != 0 || errOut.Len() == 0 {
+			t.Errorf("\n wrong output for %q. \nout %q \nerrOut %q", tt.args, out.String(), errOut.String())
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn"
+	new := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\n"
+	expected := "--- old\n+++ new\n" +
+		"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+		"@@ -11,4 +11,4 @@\n k\n l\n m\n-n\n\\ No newline at end of file\n+n\n"
+	if got := string(unifiedDiff("old", "new", []byte(old), []byte(new))); got != expected {
+		t.Errorf("\n wrong diff. \ngot %q \nwanted %q", got, expected)
+	}
+	if d := unifiedDiff("old", "new", []byte(old), []byte(old)); d != nil {
+		t.Errorf("\n expected no diff, got %q", d)
+	}
+}
+
+// diffLines has to find the shortest diff; checked against the longest common subsequence of random files.
+func TestDiffLines(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, r.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(3)))
+		}
+		return lines
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := randomLines(), randomLines()
+		edits := diffLines(a, b)
+
+		var gotA, gotB []string
+		changes := 0
+		for _, e := range edits {
+			if e.op != '+' {
+				gotA = append(gotA, e.line)
+			}
+			if e.op != '-' {
+				gotB = append(gotB, e.line)
+			}
+			if e.op != ' ' {
+				changes++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("\n the edits of %q and %q do not turn one into the other: %q", a, b, edits)
+		}
+
+		// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		if expected := len(a) + len(b) - 2*lcs[0][0]; changes != expected {
+			t.Fatalf("\n the diff of %q and %q is not the shortest. \ngot %d changes \nwanted %d", a, b, changes, expected)
+		}
+	}
+}
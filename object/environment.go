@@ -0,0 +1,45 @@
+package object
+
+/*
+Environment is what we use to keep track of values bound by let statements.
+eg after evaluating;
+
+	let x = 5;
+
+the environment associates the name x with the *Integer 5.
+
+outer is the environment that encloses this one. When a function is called, its body is
+evaluated in a new environment enclosed by the function's own environment; so that the
+function's parameters do not overwrite bindings of the same name outside the function.
+*/
+type Environment struct {
+	store map[string]Object
+	outer *Environment
+}
+
+func NewEnvironment() *Environment {
+	s := make(map[string]Object)
+	return &Environment{store: s, outer: nil}
+}
+
+// NewEnclosedEnvironment creates an environment whose lookups fall back to outer.
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// Get looks up name in this environment and, if it is not found, in the enclosing ones.
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+// Set binds name to val in this environment.
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name] = val
+	return val
+}
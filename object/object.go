@@ -0,0 +1,167 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/komuw/cali/ast"
+	"github.com/komuw/cali/token"
+)
+
+/*
+THE OBJECT SYSTEM
+
+When we evaluate cali source code, we need values to represent what the AST(produced by the parser) stands for.
+eg, when we evaluate;
+
+	let x = 5 * 5;
+
+we need a value to store in x; the integer 25.
+Every value we encounter while evaluating cali source code is represented as an Object.
+
+ObjectType is a string. Unlike token.TokenType(an int) it is not used to index lookup tables, so we keep it readable.
+*/
+type ObjectType string
+
+const (
+	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
+	STRING_OBJ       = "STRING"
+	BOOLEAN_OBJ      = "BOOLEAN"
+	NULL_OBJ         = "NULL"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	ERROR_OBJ        = "ERROR"
+	FUNCTION_OBJ     = "FUNCTION"
+)
+
+/*
+Object is an interface and not a struct because every value needs a different internal representation.
+eg an integer wraps an int64 whereas a function needs its parameters and body.
+Inspect() returns the value as cali source code would print it.
+*/
+type Object interface {
+	Type() ObjectType
+	Inspect() string
+}
+
+// Integer wraps the int64 that an *ast.IntegerLiteral evaluates to.
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+
+/*
+Float wraps the float64 that an *ast.FloatLiteral evaluates to.
+Inspect always prints a float so that it can not be mistaken for an integer; 42.0 and not 42
+*/
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+/*
+BigInteger is an integer that does not fit in an int64.
+It has the same ObjectType as Integer; for cali code there is only one kind of integer, the evaluator
+switches between the two representations as needed. A BigInteger whose value fits in an int64 is
+always turned back into an Integer.
+*/
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (bi *BigInteger) Type() ObjectType { return INTEGER_OBJ }
+func (bi *BigInteger) Inspect() string  { return bi.Value.String() }
+
+// String wraps the string that an *ast.StringLiteral evaluates to.
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+// Boolean is the result of comparisons like; 5 < 10
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+
+/*
+Null represents the absence of a value.
+It wraps nothing, since it has no value.
+*/
+type Null struct{}
+
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "null" }
+
+/*
+ReturnValue wraps the value of a return statement.
+The evaluator passes it up through the statements being evaluated(eg nested blocks) until it reaches
+the function call or program, which then unwraps it and stops evaluating further statements.
+*/
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+/*
+Error is what the evaluator produces when something goes wrong while evaluating;
+eg for  5 + true; Message is "type mismatch: INTEGER + BOOLEAN"
+Just like ReturnValue, it stops the evaluation of any further statements.
+Pos is where in the source code the error happened.
+*/
+type Error struct {
+	Message string
+	Pos     token.Position
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+	return "ERROR: " + e.Message
+}
+
+/*
+Function is the value that a function literal evaluates to.
+Env is the environment the function was defined in. That is what allows closures;
+a function has access to the bindings that existed where it was defined, not just where it is called.
+*/
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(f.Body.String())
+	return out.String()
+}
@@ -0,0 +1,163 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/komuw/cali/token"
+)
+
+/*
+ErrorKind classifies parser errors; so that tools(eg an editor) can tell the different failures apart
+without having to look at the error messages.
+*/
+type ErrorKind int
+
+const (
+	// UnexpectedToken is reported when the next token is not the one the grammar requires; eg let = 5;
+	UnexpectedToken ErrorKind = iota
+	// NoPrefixParseFn is reported when a token can not start an expression; eg let x = ;
+	NoPrefixParseFn
+	// InvalidInteger is reported for an integer literal that is malformed; eg 1__0. One that is too big for an int64 is
+	// not an error, it is parsed into a big.Int
+	InvalidInteger
+	// IllegalToken is reported for input the lexer could not make sense of; eg a string literal that is not terminated.
+	IllegalToken
+	// InvalidFloat is reported when a float literal can not be converted to a float64.
+	InvalidFloat
+	// Canceled is reported when parsing was stopped by cancelling the context passed to NewConcurrentParser.
+	Canceled
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case UnexpectedToken:
+		return "UnexpectedToken"
+	case NoPrefixParseFn:
+		return "NoPrefixParseFn"
+	case InvalidInteger:
+		return "InvalidInteger"
+	case IllegalToken:
+		return "IllegalToken"
+	case InvalidFloat:
+		return "InvalidFloat"
+	case Canceled:
+		return "Canceled"
+	default:
+		return fmt.Sprintf("ErrorKind(%d)", int(k))
+	}
+}
+
+/*
+Error is a parse error.
+Pos and End delimit the offending token in the source code.
+Expected is only set for errors of kind UnexpectedToken; it is the token type the parser wanted.
+For the other kinds it is token.ILLEGAL, the zero value.
+Actual is the type of the offending token.
+*/
+type Error struct {
+	Kind     ErrorKind
+	Pos      token.Position
+	End      token.Position
+	Expected token.TokenType
+	Actual   token.TokenType
+	Msg      string
+}
+
+// Error returns the error in the form; file:line:column: message
+func (e *Error) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Msg
+	}
+	return e.Msg
+}
+
+/*
+Snippet renders the error together with the line of src it occurred on, and underlines the offending token.
+src has to be the source code that was parsed. eg;
+
+	main.cali:3:5: expected next token to be IDENT, got = instead
+	let = 10;
+	    ^
+*/
+func (e *Error) Snippet(src string) string {
+	var out strings.Builder
+	out.WriteString(e.Error())
+	if !e.Pos.IsValid() || e.Pos.Offset > len(src) {
+		return out.String()
+	}
+
+	lineStart := strings.LastIndexByte(src[:e.Pos.Offset], '\n') + 1
+	lineEnd := strings.IndexByte(src[lineStart:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(src)
+	} else {
+		lineEnd += lineStart
+	}
+	line := strings.TrimSuffix(src[lineStart:lineEnd], "\r")
+	out.WriteString("\n")
+	out.WriteString(line)
+	out.WriteString("\n")
+
+	/*
+		keep tabs, so that the caret lines up with the token no matter how wide the terminal renders a tab.
+		We write one space per char(rune) and not per byte; é is two bytes wide but takes up one column.
+	*/
+	for _, ch := range src[lineStart:e.Pos.Offset] {
+		if ch == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+	end := e.End.Offset
+	if limit := lineStart + len(line); end > limit {
+		end = limit
+	}
+	width := 0
+	if end > e.Pos.Offset {
+		width = utf8.RuneCountInString(src[e.Pos.Offset:end])
+	}
+	if width < 1 {
+		width = 1
+	}
+	out.WriteString(strings.Repeat("^", width))
+	return out.String()
+}
+
+/*
+ErrorList is the list of errors encountered while parsing a program, in the order they were encountered.
+It implements the error interface so that it can be returned as a single error, and it supports errors.As;
+
+	var perr *parser.Error
+	if errors.As(p.Errors().Err(), &perr) { ... }
+*/
+type ErrorList []*Error
+
+func (el ErrorList) Error() string {
+	switch len(el) {
+	case 0:
+		return "no errors"
+	case 1:
+		return el[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", el[0], len(el)-1)
+}
+
+// Unwrap returns the errors in the list; it is what lets errors.Is and errors.As look into the list.
+func (el ErrorList) Unwrap() []error {
+	errs := make([]error, len(el))
+	for i, e := range el {
+		errs[i] = e
+	}
+	return errs
+}
+
+// Err returns an error equivalent to this list, or nil if the list is empty.
+func (el ErrorList) Err() error {
+	if len(el) == 0 {
+		return nil
+	}
+	return el
+}
@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/komuw/cali/lexer"
+	"github.com/komuw/cali/token"
+)
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedKind     ErrorKind
+		expectedExpected token.TokenType
+		expectedActual   token.TokenType
+		expectedPos      token.Position
+	}{
+		{"let = 5;", UnexpectedToken, token.IDENT, token.ASSIGN, token.Position{Offset: 4, Line: 1, Column: 5}},
+		{"let x 5;", UnexpectedToken, token.ASSIGN, token.INT, token.Position{Offset: 6, Line: 1, Column: 7}},
+		{"let x = ;", NoPrefixParseFn, token.ILLEGAL, token.SEMICOLON, token.Position{Offset: 8, Line: 1, Column: 9}},
+		{"1__0;", InvalidInteger, token.ILLEGAL, token.INT, token.Position{Offset: 0, Line: 1, Column: 1}},
+		{"1e999;", InvalidFloat, token.ILLEGAL, token.FLOAT, token.Position{Offset: 0, Line: 1, Column: 1}},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		_ = p.ParseProgram()
+
+		errs := p.Errors()
+		if len(errs) == 0 {
+			t.Fatalf("\n No errors found for %q.", tt.input)
+		}
+		e := errs[0]
+		if e.Kind != tt.expectedKind {
+			t.Errorf("\n wrong Kind for %q. \ngot %s \nwanted %s", tt.input, e.Kind, tt.expectedKind)
+		}
+		if e.Expected != tt.expectedExpected {
+			t.Errorf("\n wrong Expected for %q. \ngot %q \nwanted %q", tt.input, e.Expected, tt.expectedExpected)
+		}
+		if e.Actual != tt.expectedActual {
+			t.Errorf("\n wrong Actual for %q. \ngot %q \nwanted %q", tt.input, e.Actual, tt.expectedActual)
+		}
+		if e.Pos != tt.expectedPos {
+			t.Errorf("\n wrong Pos for %q. \ngot %#+v \nwanted %#+v", tt.input, e.Pos, tt.expectedPos)
+		}
+	}
+}
+
+func TestErrorListAs(t *testing.T) {
+	l := lexer.NewLexer("let = 5;")
+	p := NewParser(l)
+	_ = p.ParseProgram()
+
+	err := p.Errors().Err()
+	if err == nil {
+		t.Fatal("\n expected an error, got nil")
+	}
+	var perr *Error
+	if !errors.As(err, &perr) {
+		t.Fatalf("\n errors.As could not find a *Error in %#+v", err)
+	}
+	if perr.Kind != UnexpectedToken {
+		t.Errorf("\n wrong Kind. \ngot %s \nwanted %s", perr.Kind, UnexpectedToken)
+	}
+
+	var empty ErrorList
+	if empty.Err() != nil {
+		t.Errorf("\n expected nil error for an empty list, got %#+v", empty.Err())
+	}
+}
+
+func TestErrorSnippet(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x = 5;\nlet = 10;\n",
+			"main.cali:2:5: expected next token to be IDENT, got = instead\nlet = 10;\n    ^",
+		},
+		{
+			"let x = 5;\n\tlet y 10;",
+			"main.cali:2:8: expected next token to be =, got INT instead\n\tlet y 10;\n\t      ^^",
+		},
+		{
+			"let x = 5",
+			"main.cali:1:10: expected next token to be ;, got EOF instead\nlet x = 5\n         ^",
+		},
+		{
+			"let café = 5;\nlet jina 名前;",
+			"main.cali:2:10: expected next token to be =, got IDENT instead\nlet jina 名前;\n         ^^",
+		},
+	}
+	for _, tt := range tests {
+		l := lexer.NewFileLexer("main.cali", tt.input)
+		p := NewParser(l)
+		_ = p.ParseProgram()
+
+		errs := p.Errors()
+		if len(errs) == 0 {
+			t.Fatalf("\n No errors found for %q.", tt.input)
+		}
+		if got := errs[0].Snippet(tt.input); got != tt.expected {
+			t.Errorf("\n wrong snippet. \ngot \n%s \nwanted \n%s", got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/komuw/cali/ast"
+	"github.com/komuw/cali/internal/testcorpus"
+	"github.com/komuw/cali/lexer"
+	"github.com/komuw/cali/token"
+)
+
+/*
+fuzzSeeds is the seed corpus of FuzzParser; inputs like the ones of the other tests in this package, including the
+ones that have errors. go test runs FuzzParser with just these; go test -fuzz=FuzzParser makes up new inputs from them.
+*/
+var fuzzSeeds = []string{
+	"",
+	"let x = 5;\nlet y = 10;\nlet foobar = 838383;",
+	"let x = 5",
+	"let x 5;\nlet = 10;\nlet 838383;",
+	"return 5;\nreturn 10;\nreturn add(15);",
+	"-a * b; !-a; a + b + c; a * b / c; 5 > 4 == 3 < 4; 3 + 4 * 5 == 3 * 1 + 4 * 5; (5 + 5) * 2; -(5 + 5); !(true == true);",
+	"a + add(b * c) + d; add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8)); add(a + b + c * d / f + g);",
+	"if (x < y) { x; } else { y; }",
+	"if (x < y) { x }",
+	"let add = fn(x, y) { return x + y; }; add(1, 2); fn() {}; fn(x, y, z) {};",
+	"fn(x, 5) { x; }; add(1, 2",
+	`let s = "hello world"; let t = "bad \q escape"; let z = 1__0; let big = 99999999999999999999;`,
+	"let x = 0x2A * 4.2e1; // a comment\n/* a /* nested */ comment */ let y = \"名前\";",
+	"let x = 5 @ \x00 \xff;",
+	"(((((((((( 1;",
+	"}}}} )))) ;;;;",
+	testcorpus.Benchmark[:400],
+}
+
+/*
+FuzzParser checks that for any input, the parser;
+
+	stops; it does not ask the lexer for more tokens than the input has bytes(plus a few), and does not loop without doing so
+	does not panic
+	reports errors and builds nodes with positions that are in the input
+	builds an AST whose String parses back to it(see roundTrip), if there are no errors
+*/
+func FuzzParser(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		l := lexer.NewFileLexer("main.cali", input)
+		p := NewParser(l)
+		// the lexer returns at most one token per byte of input and then EOF(see lexer.FuzzLexer). A parser that wants a
+		// lot more than that is stuck at the EOF; give it EOFs so that it can still be caught, instead of it never stopping.
+		budget := 2*len(input) + 16
+		tokens := 0
+		p.next = func() token.Token {
+			tokens++
+			if tokens > budget {
+				eof := token.Position{Filename: "main.cali", Offset: len(input)}
+				return token.Token{Type: token.EOF, Pos: eof, End: eof}
+			}
+			return l.NextToken()
+		}
+
+		done := make(chan *ast.Program)
+		go func() {
+			done <- p.ParseProgram()
+		}()
+		var program *ast.Program
+		select {
+		case program = <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("\n parser does not stop for %q; %d tokens so far", input, tokens)
+		}
+		if tokens > budget {
+			t.Fatalf("\n parser does not stop for %q; it wanted %d tokens", input, tokens)
+		}
+
+		for _, e := range p.Errors() {
+			if !e.Pos.IsValid() || e.Pos.Offset > e.End.Offset || e.End.Offset > len(input) {
+				t.Fatalf("\n error %q of %q is out of place; %d to %d", e, input, e.Pos.Offset, e.End.Offset)
+			}
+			if snippet := e.Snippet(input); !strings.HasPrefix(snippet, e.Error()) {
+				t.Fatalf("\n wrong snippet for error %q of %q. \ngot %q", e, input, snippet)
+			}
+		}
+		ast.Inspect(program, func(n ast.Node) bool {
+			if n == nil {
+				return true
+			}
+			if pos := n.Pos(); pos.IsValid() && pos.Offset > len(input) {
+				t.Fatalf("\n node %q of %q is out of place; at %d", n.String(), input, pos.Offset)
+			}
+			return true
+		})
+
+		if len(p.Errors()) == 0 {
+			roundTrip(t, program)
+		}
+	})
+}
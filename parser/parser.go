@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"context"
 	"fmt"
+	"math/big"
 	"strconv"
 
 	"github.com/komuw/cali/ast"
@@ -9,6 +11,13 @@ import (
 	"github.com/komuw/cali/token"
 )
 
+/*
+Version identifies the ASTs this parser produces. It is part of the key of cached ASTs(see package cache), so that
+an AST parsed by an older cali is never used. Bump it whenever a change to the lexer, the parser or package ast
+changes the AST produced for some input.
+*/
+const Version = 2
+
 /*
 constants showing operator precendence of cali language.
 
@@ -26,6 +35,35 @@ const (
 	OpCall             // myFunction(X)
 )
 
+/*
+precedences associates token types with their precedence.
+eg token.PLUS and token.MINUS have the same precedence, which is lower than that of token.ASTERISK and token.SLASH
+Tokens that are not in this table(like token.SEMICOLON) have the precedence OpLowest; the zero value.
+It is an array indexed by token type and not a map, since token types are small ints; see token.TokenType
+*/
+var precedences = [token.NumTokens]int{
+	token.EQ:       OpEqualsEquals,
+	token.NOT_EQ:   OpEqualsEquals,
+	token.LT:       OpLessGreater,
+	token.GT:       OpLessGreater,
+	token.PLUS:     OpPlus,
+	token.MINUS:    OpPlus,
+	token.SLASH:    OpMultiplier,
+	token.ASTERISK: OpMultiplier,
+	token.LPAREN:   OpCall,
+}
+
+/*
+Precedence returns the precedence of the infix operator t; OpLowest if t is not one.
+It is for code that prints ASTs(see package format), which has to know where parentheses are needed.
+*/
+func Precedence(t token.TokenType) int {
+	if t < 0 || t >= token.NumTokens {
+		return OpLowest
+	}
+	return precedences[t]
+}
+
 /*
 A Pratt parser’s main idea is the association of parsing funcs with token types.
 Each token type can have up to two parsing funcs associated with it, depending on whether the
@@ -52,36 +90,134 @@ we are at the end of the line or if we are at just the start of an arithmetic ex
 */
 type Parser struct {
 	l         *lexer.Lexer
+	next      func() token.Token // returns the next token from l; see NewParser and NewConcurrentParser
 	curToken  token.Token
 	peekToken token.Token
-	errors    []string
+	errors    ErrorList
+	panicMode bool               // set on the first error of a statement; see synchronize
+	canceled  bool               // set when the lexer of a NewConcurrentParser was stopped; see addError
+	stop      context.CancelFunc // stops the lexer of a NewConcurrentParser once ParseProgram is done; nil for NewParser
 
-	prefixParseFns map[token.TokenType]prefixParseFn
-	infixParseFns  map[token.TokenType]infixParseFn
+	// indexed by token type. A nil entry means the token type has no parsing func.
+	prefixParseFns [token.NumTokens]prefixParseFn
+	infixParseFns  [token.NumTokens]infixParseFn
 }
 
 func NewParser(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, next: l.NextToken, errors: ErrorList{}}
+	p.init()
+	return p
+}
+
+/*
+NewConcurrentParser is like NewParser, but l lexes in its own goroutine and sends the tokens to the parser
+over a channel; see lexer.Lexer.Tokens
+This pays off for big inputs, since lexing and parsing then happen at the same time.
+
+Cancelling ctx stops the lexer. ParseProgram then stops too and the error list contains an error of kind Canceled.
+ParseProgram stops the lexer when it returns, even if it did not get to the end of the input(eg it panicked).
+A parser whose ParseProgram is never called keeps the lexer goroutine around until ctx is cancelled.
+l must not be used(except for calling Errors) after it has been passed to NewConcurrentParser.
+*/
+func NewConcurrentParser(ctx context.Context, l *lexer.Lexer) *Parser {
+	ctx, stop := context.WithCancel(ctx)
+	tokens := l.Tokens(ctx)
+	p := &Parser{l: l, errors: ErrorList{}, stop: stop}
+	var eof *token.Token
+	p.next = func() token.Token {
+		if eof != nil {
+			// like NextToken, keep on returning EOF once we are at the end of the input.
+			return *eof
+		}
+		tok, ok := <-tokens
+		if !ok {
+			// the lexer stopped before the end of the input. Pretend we are at the end, so that parsing stops.
+			tok = token.Token{Type: token.EOF, Pos: p.peekToken.End, End: p.peekToken.End}
+			p.canceled = true
+			p.errors = append(p.errors, &Error{Kind: Canceled, Pos: tok.Pos, End: tok.End, Actual: token.EOF, Msg: ctx.Err().Error()})
+		}
+		if tok.Type == token.EOF {
+			eof = &tok
+		}
+		return tok
+	}
+	p.init()
+	return p
+}
+
+// init reads the first two tokens and registers the parsing funcs.
+func (p *Parser) init() {
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
 	p.nextToken()
 
 	/*
-		create prefixParseFns map and register funcs for various tokens.
+		register prefixParseFns for various tokens.
 		if we encounter a type token.IDENT the parsing function to call is p.parseIdentifier
 	*/
-	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.prefixParseFns[token.IDENT] = p.parseIdentifier // equivalent to p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.prefixParseFns[token.INT] = p.parseIntegerLiteral
-	return p
+	p.prefixParseFns[token.FLOAT] = p.parseFloatLiteral
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
+	p.registerPrefix(token.BANG, p.parsePrefixExpression)
+	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.TRUE, p.parseBoolean)
+	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefix(token.IF, p.parseIfExpression)
+
+	/*
+		every binary operator gets the same infix parsing function; parseInfixExpression.
+		It is the precedences table that tells the operators apart.
+	*/
+	for _, tokenType := range []token.TokenType{
+		token.PLUS, token.MINUS, token.SLASH, token.ASTERISK,
+		token.EQ, token.NOT_EQ, token.LT, token.GT,
+	} {
+		p.registerInfix(tokenType, p.parseInfixExpression)
+	}
+	/*
+		a call is an infix expression too; the ( is "in the middle" of the function and its arguments; add(2, 3)
+		It has the highest precedence(OpCall) so that in; -add(1); the - applies to the result of the call.
+	*/
+	p.registerInfix(token.LPAREN, p.parseCallExpression)
 }
-func (p *Parser) Errors() []string {
+
+// Errors returns the errors encountered while parsing, see Error.
+func (p *Parser) Errors() ErrorList {
 	return p.errors
 }
+
+/*
+addError records an error of the given kind for tok.
+Only the first error of a statement is recorded. Once a statement has gone wrong, the errors that follow are
+usually just a consequence of that first one(eg; let x 5; would otherwise also complain about 5 and ;).
+So we enter "panic mode" and stay silent until synchronize has found a place where parsing can sensibly resume.
+*/
+func (p *Parser) addError(kind ErrorKind, tok token.Token, expected token.TokenType, format string, a ...interface{}) {
+	if p.panicMode || p.canceled {
+		// once canceled, the input is cut short and any further errors are only noise.
+		return
+	}
+	p.panicMode = true
+	p.errors = append(p.errors, &Error{
+		Kind:     kind,
+		Pos:      tok.Pos,
+		End:      tok.End,
+		Expected: expected,
+		Actual:   tok.Type,
+		Msg:      fmt.Sprintf(format, a...),
+	})
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	// TODO: add line numbers to this errors
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(UnexpectedToken, p.peekToken, t, "expected next token to be %s, got %s instead", t, p.peekToken.Type)
+}
+
+func (p *Parser) noPrefixParseFnError(t token.TokenType) {
+	p.addError(NoPrefixParseFn, p.curToken, token.ILLEGAL, "no prefix parse function for %s found", t)
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
@@ -93,7 +229,11 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	p.peekToken = p.next()
+	for p.peekToken.Type == token.COMMENT {
+		// comments do not matter to the parser.
+		p.peekToken = p.next()
+	}
 }
 
 /*
@@ -103,14 +243,27 @@ ParseProgram :
    nextToken() advances both p.curToken and p.peekToken
 3. In every iteration it calls parseStatement, whose job it is to parse a statement.
 If parseStatement returned something(not nil), its return value is added to Statements slice
+   If parsing the statement failed, we synchronize and carry on with the next statement.
+   That way we report every broken statement(once) and still return the statements that were fine.
 4. When nothing is left to parse the *ast.Program root node is returned.
 */
 func (p *Parser) ParseProgram() *ast.Program {
+	if p.stop != nil {
+		defer p.stop()
+	}
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
 	for p.curToken.Type != token.EOF {
 		stmt := p.parseStatement()
+		if p.panicMode {
+			p.synchronize()
+			if p.curTokenIs(token.RBRACE) {
+				// a } at the top level does not close anything. skip it.
+				p.nextToken()
+			}
+			continue
+		}
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
@@ -119,6 +272,44 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+/*
+synchronize implements panic-mode error recovery.
+After an error, the parser does not know where in the grammar it is. So we discard tokens until we get to a
+point where a new statement is likely to start;
+  - just after a ;
+  - just before a } since that ends the block we are in.
+  - just before one of the keywords that start a statement(or a function/if expression); let, return, fn, if
+Blocks that are opened while discarding are discarded as a whole; eg in fn(x, 5) { x; }; the ; inside the body
+is not where the broken statement ends.
+Then we leave panic mode, so that errors in the following statements get reported again.
+*/
+func (p *Parser) synchronize() {
+	p.panicMode = false
+	depth := 0 // how many { we have discarded without their }
+	for !p.curTokenIs(token.EOF) {
+		switch {
+		case p.curTokenIs(token.LBRACE):
+			depth++
+		case p.curTokenIs(token.RBRACE):
+			if depth == 0 {
+				return
+			}
+			depth--
+		case p.curTokenIs(token.SEMICOLON) && depth == 0:
+			p.nextToken()
+			return
+		}
+		if depth == 0 {
+			switch p.peekToken.Type {
+			case token.LET, token.RETURN, token.FUNCTION, token.IF:
+				p.nextToken()
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	/*
@@ -139,8 +330,9 @@ parseLetStatement:
 1. constructs an *ast.LetStatement node with the current token(token.LET)
 2. advances the tokens while making assertions about the next token with calls to expectPeek.
   - First it expects a token.IDENT, which it then uses to construct an *ast.Identifier node
-  - Then it expects an equal sign and finally it SKIPS over the expression following the equal sign until it encounters a semicolon.
-  The skipping of expressions will be replaced, of course, as soon as we know how to parse expressions.
+  - Then it expects an equal sign and finally it parses the expression following the equal sign.
+3. The statement has to be terminated by a semicolon. If it isn't(eg; let x = 5 followed by EOF) we record an error
+  instead of looking for the semicolon forever.
 */
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
@@ -152,10 +344,13 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
-	// TODO: SKIP parsing expressions until we know how to parse them.
-	// Continue until we encounter a semicolon
-	for !p.curTokenIs(token.SEMICOLON) {
-		p.nextToken()
+	p.nextToken()
+	stmt.Value = p.parseExpression(OpLowest)
+	if stmt.Value == nil {
+		return nil
+	}
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
 	}
 	return stmt
 }
@@ -182,14 +377,21 @@ func (p *Parser) peekTokenIs(t token.TokenType) bool {
 	return p.peekToken.Type == t
 }
 
+/*
+parseReturnStatement parses statements of the form;
+	return <expression>;
+Just like let statements, the semicolon is required.
+*/
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 	p.nextToken()
 
-	// TODO: SKIP parsing expressions until we know how to parse them.
-	// Continue until we encounter a semicolon
-	for !p.curTokenIs(token.SEMICOLON) {
-		p.nextToken()
+	stmt.ReturnValue = p.parseExpression(OpLowest)
+	if stmt.ReturnValue == nil {
+		return nil
+	}
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
 	}
 	return stmt
 }
@@ -199,15 +401,28 @@ parseExpressionStatement parses expressions
 */
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
-	stmt.Expression = p.parseExpression(OpLowest)
+	if p.curTokenIs(token.IF) {
+		/*
+			An if expression that starts a statement is not the left side of an infix expression.
+			Otherwise; if (x) { 1; } -1; would be parsed as; (if (x) { 1; }) - 1
+		*/
+		stmt.Expression = p.parseIfExpression()
+	} else {
+		stmt.Expression = p.parseExpression(OpLowest)
+	}
+	if stmt.Expression == nil {
+		return nil
+	}
 
 	/*
 		Unlike in the interpreter book, in cali we stop on finding semicolon.
 		In cali we wont allow code like; 5+5 (it has to be 5+5;)
+		The exception are expressions that end with a block, like; if (x) { y; }
+		There the semicolon is optional; just like after a block in most languages.
 	*/
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
-	} else {
+	} else if !p.curTokenIs(token.RBRACE) {
 		p.peekError(token.SEMICOLON)
 		return nil
 	}
@@ -216,18 +431,51 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 /*
 parseExpression checks whether we have a parsing function associated with p.curToken.Type in the prefix position.
-If we do, it calls this parsing function, else returns nil.
+If we do, it calls this parsing function, else it records an error and returns nil.
+
+It then tries to find infixParseFns for the next token. If it finds such a function, it calls it, passing in the
+expression returned by the prefixParseFn as an argument. It does all this again and again until it encounters
+a token that has a lower(or equal) precedence than the precedence argument.
+eg for; 1 + 2 * 3;
+when parsing the + its right side is parsed with precedence OpPlus, the * has a higher precedence so it binds 2 * 3.
+The AST thus is; (1 + (2 * 3))
 */
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
 		// We didn't find a prefixParse func defined for that token.
+		p.noPrefixParseFnError(p.curToken.Type)
 		return nil
 	}
 	leftExp := prefix()
+	if leftExp == nil {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+		infix := p.infixParseFns[p.peekToken.Type]
+		if infix == nil {
+			return leftExp
+		}
+		p.nextToken()
+		leftExp = infix(leftExp)
+		if leftExp == nil {
+			return nil
+		}
+	}
 	return leftExp
 }
 
+// peekPrecedence returns the precedence associated with the token type of p.peekToken
+func (p *Parser) peekPrecedence() int {
+	return precedences[p.peekToken.Type]
+}
+
+// curPrecedence returns the precedence associated with the token type of p.curToken
+func (p *Parser) curPrecedence() int {
+	return precedences[p.curToken.Type]
+}
+
 /*
 parseIdentifier returns a *ast.Identifier with the current
 token in the Token field & value of the token in Value.
@@ -245,15 +493,293 @@ func (p *Parser) parseIdentifier() ast.Expression {
 /*
 parseIntegerLiteral() like parseIdentifier is strikingly simple. The only thing that’s really different
 is a call to strconv.ParseInt, which converts the string in p.curToken.Value into an int64.
+cali integers have no maximum size; literals that are too big for an int64 are parsed into a big.Int instead.
 */
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 	value, err := strconv.ParseInt(p.curToken.Value, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Value)
-		p.errors = append(p.errors, msg)
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			if b, ok := new(big.Int).SetString(p.curToken.Value, 0); ok {
+				lit.Big = b
+				return lit
+			}
+		}
+		p.addError(InvalidInteger, p.curToken, token.ILLEGAL, "could not parse %q as integer", p.curToken.Value)
 		return nil
 	}
 	lit.Value = value
 	return lit
 }
+
+// parseFloatLiteral is parseIntegerLiteral for floats; it uses strconv.ParseFloat instead.
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+	value, err := strconv.ParseFloat(p.curToken.Value, 64)
+	if err != nil {
+		p.addError(InvalidFloat, p.curToken, token.ILLEGAL, "could not parse %q as float", p.curToken.Value)
+		return nil
+	}
+	lit.Value = value
+	return lit
+}
+
+/*
+parsePrefixExpression builds an *ast.PrefixExpression for input like; -5 or !foobar
+Unlike the other prefix parsing funcs it advances the tokens, since it needs the expression that follows the operator.
+That expression is parsed with precedence OpPrefix, so that in; -a * b; the - only binds to a.
+*/
+func (p *Parser) parsePrefixExpression() ast.Expression {
+	expression := &ast.PrefixExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Value,
+	}
+	p.nextToken()
+	expression.Right = p.parseExpression(OpPrefix)
+	if expression.Right == nil {
+		return nil
+	}
+	return expression
+}
+
+/*
+parseInfixExpression is called with curToken being the operator and left being the already parsed left side.
+It parses the right side with the precedence of the operator. That is what makes; 1 + 2 + 3; left associative ((1 + 2) + 3)
+since the second + does not have a higher precedence than the first one.
+*/
+func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
+	expression := &ast.InfixExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Value,
+		Left:     left,
+	}
+	precedence := p.curPrecedence()
+	p.nextToken()
+	expression.Right = p.parseExpression(precedence)
+	if expression.Right == nil {
+		return nil
+	}
+	return expression
+}
+
+/*
+parseBlockStatement parses the statements between { and }.
+It is called with curToken being the { and returns with curToken being the }.
+Errors inside the block are recovered from just like at the top level(see ParseProgram), so a mistake in one
+statement of a function body does not hide mistakes in the statements after it.
+*/
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.curToken}
+	block.Statements = []ast.Statement{}
+	p.nextToken()
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		stmt := p.parseStatement()
+		if p.panicMode {
+			p.synchronize()
+			continue
+		}
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.nextToken()
+	}
+	if !p.curTokenIs(token.RBRACE) {
+		/*
+			at the EOF, a block that is in another one that is not closed either has already reported this error.
+			synchronize has taken us out of panic mode since, so addError would report it again for every enclosing block.
+		*/
+		if n := len(p.errors); n > 0 && p.errors[n-1].Pos == p.curToken.Pos && p.errors[n-1].Expected == token.RBRACE {
+			p.panicMode = true
+			return nil
+		}
+		p.addError(UnexpectedToken, p.curToken, token.RBRACE, "expected next token to be %s, got %s instead", token.RBRACE, p.curToken.Type)
+		return nil
+	}
+	block.Rbrace = p.curToken
+	return block
+}
+
+/*
+parseFunctionLiteral parses; fn(x, y) { x + y; }
+It expects, in that order; the parameters in parentheses and then the body in braces.
+*/
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	lit.Body = p.parseBlockStatement()
+	if lit.Body == nil {
+		return nil
+	}
+	return lit
+}
+
+/*
+parseFunctionParameters parses a comma separated list of identifiers; (x, y)
+It is called with curToken being the ( and returns with curToken being the ).
+A function with no parameters gets an empty(not nil) list; nil means parsing the parameters failed.
+*/
+func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+	identifiers := []*ast.Identifier{}
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return identifiers
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Value})
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Value})
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	return identifiers
+}
+
+/*
+parseCallExpression is the infixParseFn for (
+function is the already parsed expression to the left of the (; eg the identifier add in add(2, 3)
+*/
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	exp := &ast.CallExpression{Token: p.curToken, Function: function}
+	exp.Arguments = p.parseCallArguments()
+	if exp.Arguments == nil {
+		return nil
+	}
+	exp.Rparen = p.curToken
+	return exp
+}
+
+/*
+parseCallArguments parses a comma separated list of expressions; (1, 2 * 3, add(4, 5))
+Just like parseFunctionParameters; an empty list means no arguments and nil means parsing failed.
+*/
+func (p *Parser) parseCallArguments() []ast.Expression {
+	args := []ast.Expression{}
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return args
+	}
+
+	p.nextToken()
+	arg := p.parseExpression(OpLowest)
+	if arg == nil {
+		return nil
+	}
+	args = append(args, arg)
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		arg := p.parseExpression(OpLowest)
+		if arg == nil {
+			return nil
+		}
+		args = append(args, arg)
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	return args
+}
+
+// parseBoolean builds an *ast.Boolean for both true and false.
+func (p *Parser) parseBoolean() ast.Expression {
+	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+}
+
+/*
+parseGroupedExpression parses; (5 + 5)
+The parentheses do not end up in the AST. They only make the expression inside them get parsed with the lowest
+precedence, starting afresh. That is all that is needed to make; (5 + 5) * 2; become ((5 + 5) * 2)
+*/
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	p.nextToken()
+	exp := p.parseExpression(OpLowest)
+	if exp == nil {
+		return nil
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	return exp
+}
+
+/*
+parseIfExpression parses;
+	if (<condition>) <consequence> else <alternative>
+where the else and its alternative are optional.
+The parentheses around the condition are required.
+*/
+func (p *Parser) parseIfExpression() ast.Expression {
+	expression := &ast.IfExpression{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Condition = p.parseExpression(OpLowest)
+	if expression.Condition == nil {
+		return nil
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Consequence = p.parseBlockStatement()
+	if expression.Consequence == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.ELSE) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Alternative = p.parseBlockStatement()
+		if expression.Alternative == nil {
+			return nil
+		}
+	}
+	return expression
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Value}
+}
+
+/*
+parseIllegal reports the token.ILLEGAL tokens that the lexer produces for input it could not make sense of;
+eg a string literal that is not terminated.
+The lexer knows what exactly is wrong, so we use its error message and position.
+*/
+func (p *Parser) parseIllegal() ast.Expression {
+	tok := p.curToken
+	msg := fmt.Sprintf("illegal token %q", tok.Value)
+	for _, e := range p.l.Errors() {
+		if tok.Pos.Offset <= e.Pos.Offset && e.Pos.Offset < tok.End.Offset {
+			tok.Pos, tok.End, msg = e.Pos, e.End, e.Msg
+			break
+		}
+	}
+	p.addError(IllegalToken, tok, token.ILLEGAL, "%s", msg)
+	return nil
+}
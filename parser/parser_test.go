@@ -1,10 +1,17 @@
 package parser
 
 import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/komuw/cali/ast"
+	"github.com/komuw/cali/internal/testcorpus"
 	"github.com/komuw/cali/lexer"
+	"github.com/komuw/cali/token"
 )
 
 /*
@@ -93,18 +100,15 @@ func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	/*
 		We get an AST(s argument) like;
 			&ast.LetStatement{
-				Token: token.Token{Type: "LET", Value: "let"},
+				Token: token.Token{Type: token.LET, Value: "let"},
 				Name: &ast.Identifier{
-					Token: token.Token{Type: "IDENT", Value: "x"},
+					Token: token.Token{Type: token.IDENT, Value: "x"},
 					Value: "x"},
-				Value: nil,
+				Value: &ast.IntegerLiteral{...},
 				}
 
-		In this test helper func we are not checking s.Value
-		This is because, that value is currently nil(instead of 5 for input like let x = 5;)
-		It is nil because the only thing our parser currently is doing is only parsing let statements.
-		It doesnt yet know how to parse expressions(the thing after the equal sign in let x = 5;)
-		see documentation for parseLetStatement func.
+		In this test helper func we are only checking the name that is bound.
+		The value(s.Value) is checked by TestLetStatementsValues.
 	*/
 	if s.TokenValue() != "let" {
 		t.Errorf("s.TokenValue not 'let'. got=%q", s.TokenValue())
@@ -163,6 +167,96 @@ func TestReturnStatements(t *testing.T) {
 	}
 }
 
+func TestLetStatementsValues(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      string
+	}{
+		{"let x = 5;", "x", "5"},
+		{"let y = x;", "y", "x"},
+		{"let foobar = 1 + 2 * y;", "foobar", "(1 + (2 * y))"},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+		stmt := program.Statements[0]
+		if !testLetStatement(t, stmt, tt.expectedIdentifier) {
+			return
+		}
+		val := stmt.(*ast.LetStatement).Value
+		if val == nil {
+			t.Fatalf("letStmt.Value is nil")
+		}
+		if val.String() != tt.expectedValue {
+			t.Errorf("letStmt.Value not %q. got=%q", tt.expectedValue, val.String())
+		}
+	}
+}
+
+func TestReturnStatementsValues(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue string
+	}{
+		{"return 5;", "5"},
+		{"return x;", "x"},
+		{"return -x + 10;", "((-x) + 10)"},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+		returnStmt, ok := program.Statements[0].(*ast.ReturnStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ReturnStatement. got=%T", program.Statements[0])
+		}
+		if returnStmt.ReturnValue == nil {
+			t.Fatalf("returnStmt.ReturnValue is nil")
+		}
+		if returnStmt.ReturnValue.String() != tt.expectedValue {
+			t.Errorf("returnStmt.ReturnValue not %q. got=%q", tt.expectedValue, returnStmt.ReturnValue.String())
+		}
+	}
+}
+
+func TestMissingSemicolonParseError(t *testing.T) {
+	/*
+		These used to loop forever looking for the semicolon.
+	*/
+	inputs := []string{
+		"let x = 5",
+		"let x = 5 + ",
+		"return 5",
+		"return",
+	}
+	for _, input := range inputs {
+		l := lexer.NewLexer(input)
+		p := NewParser(l)
+		_ = p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("\n No errors found for %q. \ngot %#+v \nwanted at least %#+v", input, len(errors), 1)
+		}
+		t.Logf("parser has %d errors", len(errors))
+		for _, msg := range errors {
+			t.Logf("parser error: %q", msg)
+		}
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
 
@@ -243,3 +337,770 @@ func TestIntegerLiteralExpression(t *testing.T) {
 			literal.TokenValue())
 	}
 }
+
+func TestNumberLiteralExpressions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue interface{}
+	}{
+		{"0x2A;", int64(42)},
+		{"0o52;", int64(42)},
+		{"0b101010;", int64(42)},
+		{"052;", int64(42)},
+		{"1_000_000;", int64(1000000)},
+		{"9223372036854775807;", int64(9223372036854775807)},
+		{"4.2;", 4.2},
+		{"4.2e1;", 42.0},
+		{"42e-1;", 4.2},
+		{"1_000.5;", 1000.5},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if len(program.Statements) != 1 {
+			t.Fatalf("program has not enough statements. got=%d", len(program.Statements))
+		}
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		switch expected := tt.expectedValue.(type) {
+		case int64:
+			literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+			if !ok {
+				t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+			}
+			if literal.Value != expected {
+				t.Errorf("literal.Value not %d. got=%d", expected, literal.Value)
+			}
+		case float64:
+			literal, ok := stmt.Expression.(*ast.FloatLiteral)
+			if !ok {
+				t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+			}
+			if literal.Value != expected {
+				t.Errorf("literal.Value not %g. got=%g", expected, literal.Value)
+			}
+		}
+	}
+}
+
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue string
+	}{
+		{"9223372036854775808;", "9223372036854775808"},
+		{"99_999_999_999_999_999_999;", "99999999999999999999"},
+		{"0xFFFFFFFFFFFFFFFFFF;", "4722366482869645213695"},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Big == nil {
+			t.Fatalf("literal.Big is nil for %q", tt.input)
+		}
+		if literal.Big.String() != tt.expectedValue {
+			t.Errorf("literal.Big not %s. got=%s", tt.expectedValue, literal.Big)
+		}
+	}
+}
+
+func TestParsingPrefixExpressions(t *testing.T) {
+	prefixTests := []struct {
+		input        string
+		operator     string
+		integerValue int64
+	}{
+		{"!5;", "!", 5},
+		{"-15;", "-", 15},
+	}
+	for _, tt := range prefixTests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+		exp, ok := stmt.Expression.(*ast.PrefixExpression)
+		if !ok {
+			t.Fatalf("stmt is not ast.PrefixExpression. got=%T", stmt.Expression)
+		}
+		if exp.Operator != tt.operator {
+			t.Fatalf("exp.Operator is not '%s'. got=%s", tt.operator, exp.Operator)
+		}
+		if !testIntegerLiteral(t, exp.Right, tt.integerValue) {
+			return
+		}
+	}
+}
+
+func TestParsingInfixExpressions(t *testing.T) {
+	infixTests := []struct {
+		input      string
+		leftValue  int64
+		operator   string
+		rightValue int64
+	}{
+		{"5 + 5;", 5, "+", 5},
+		{"5 - 5;", 5, "-", 5},
+		{"5 * 5;", 5, "*", 5},
+		{"5 / 5;", 5, "/", 5},
+		{"5 > 5;", 5, ">", 5},
+		{"5 < 5;", 5, "<", 5},
+		{"5 == 5;", 5, "==", 5},
+		{"5 != 5;", 5, "!=", 5},
+	}
+	for _, tt := range infixTests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+		exp, ok := stmt.Expression.(*ast.InfixExpression)
+		if !ok {
+			t.Fatalf("exp is not ast.InfixExpression. got=%T", stmt.Expression)
+		}
+		if !testIntegerLiteral(t, exp.Left, tt.leftValue) {
+			return
+		}
+		if exp.Operator != tt.operator {
+			t.Fatalf("exp.Operator is not '%s'. got=%s", tt.operator, exp.Operator)
+		}
+		if !testIntegerLiteral(t, exp.Right, tt.rightValue) {
+			return
+		}
+	}
+}
+
+func TestOperatorPrecedenceParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"-a * b;", "((-a) * b);"},
+		{"!-a;", "(!(-a));"},
+		{"a + b + c;", "((a + b) + c);"},
+		{"a + b - c;", "((a + b) - c);"},
+		{"a * b * c;", "((a * b) * c);"},
+		{"a * b / c;", "((a * b) / c);"},
+		{"a + b / c;", "(a + (b / c));"},
+		{"a + b * c + d / e - f;", "(((a + (b * c)) + (d / e)) - f);"},
+		{"3 + 4; -5 * 5;", "(3 + 4);((-5) * 5);"},
+		{"5 > 4 == 3 < 4;", "((5 > 4) == (3 < 4));"},
+		{"5 < 4 != 3 > 4;", "((5 < 4) != (3 > 4));"},
+		{"3 + 4 * 5 == 3 * 1 + 4 * 5;", "((3 + (4 * 5)) == ((3 * 1) + (4 * 5)));"},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestPrefixExpressionParseError(t *testing.T) {
+	input := "-;"
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	_ = p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("\n No errors found. \ngot %#+v \nwanted at least %#+v", len(errors), 1)
+	}
+	t.Logf("parser has %d errors", len(errors))
+	for _, msg := range errors {
+		t.Logf("parser error: %q", msg)
+	}
+}
+
+func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
+	integ, ok := il.(*ast.IntegerLiteral)
+	if !ok {
+		t.Errorf("il not *ast.IntegerLiteral. got=%T", il)
+		return false
+	}
+	if integ.Value != value {
+		t.Errorf("integ.Value not %d. got=%d", value, integ.Value)
+		return false
+	}
+	if integ.TokenValue() != fmt.Sprintf("%d", value) {
+		t.Errorf("integ.TokenValue not %d. got=%s", value, integ.TokenValue())
+		return false
+	}
+	return true
+}
+
+func TestParseErrorPositions(t *testing.T) {
+	input := `
+let x = 5;
+let = 10;
+`
+	l := lexer.NewFileLexer("main.cali", input)
+	p := NewParser(l)
+	_ = p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("\n No errors found. \ngot %#+v \nwanted at least %#+v", len(errors), 1)
+	}
+	expected := "main.cali:3:5: expected next token to be IDENT, got = instead"
+	if errors[0].Error() != expected {
+		t.Errorf("\n wrong error. \ngot %q \nwanted %q", errors[0], expected)
+	}
+}
+
+func TestParseErrorRecovery(t *testing.T) {
+	input := `
+	let x 5;
+	let = 10;
+	let y = 15;
+	return ;
+	let z = y * 2 + ;
+	let w = 5 let v = 6;
+	}
+	return z;
+	`
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+
+	errors := p.Errors()
+	expectedErrors := []string{
+		"2:8: expected next token to be =, got INT instead",
+		"3:6: expected next token to be IDENT, got = instead",
+		"5:9: no prefix parse function for ; found",
+		"6:18: no prefix parse function for ; found",
+		"7:12: expected next token to be ;, got LET instead",
+		"8:2: no prefix parse function for } found",
+	}
+	if len(errors) != len(expectedErrors) {
+		for _, msg := range errors {
+			t.Logf("parser error: %q", msg)
+		}
+		t.Fatalf("\n number of errors mismatch. \ngot %#+v \nwanted %#+v", len(errors), len(expectedErrors))
+	}
+	for i, expected := range expectedErrors {
+		if errors[i].Error() != expected {
+			t.Errorf("\n wrong error. \ngot %q \nwanted %q", errors[i], expected)
+		}
+	}
+
+	// the statements that were fine are still part of the program.
+	expectedStatements := []string{"let y = 15;", "let v = 6;", "return z;"}
+	if len(program.Statements) != len(expectedStatements) {
+		t.Fatalf("\n No of program.Statements. \ngot %#+v \nwanted %#+v", len(program.Statements), len(expectedStatements))
+	}
+	for i, expected := range expectedStatements {
+		if program.Statements[i].String() != expected {
+			t.Errorf("\n wrong statement. \ngot %q \nwanted %q", program.Statements[i].String(), expected)
+		}
+	}
+}
+
+func TestParseErrorReportedOnce(t *testing.T) {
+	inputs := []string{
+		"let x 5 6 7;",
+		"let x = 5 + - * ;",
+		"5 5 5 5;",
+		// nested blocks that are not closed all end at the EOF, but that is only reported once.
+		"let f = fn() { let g = fn() { 1;",
+		"if (x) { if (y) { 1;",
+		strings.Repeat("fn(){", 20000),
+	}
+	for _, input := range inputs {
+		l := lexer.NewLexer(input)
+		p := NewParser(l)
+		_ = p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			for _, msg := range errors {
+				t.Logf("parser error: %q", msg)
+			}
+			t.Errorf("\n number of errors mismatch for %.50q. \ngot %#+v \nwanted %#+v", input, len(errors), 1)
+		}
+	}
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	input := `fn(x, y) { x + y; };`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+	}
+	if len(function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d\n", len(function.Parameters))
+	}
+	if function.Parameters[0].Value != "x" || function.Parameters[1].Value != "y" {
+		t.Fatalf("function literal parameters wrong. want x, y, got=%s, %s\n", function.Parameters[0], function.Parameters[1])
+	}
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n", len(function.Body.Statements))
+	}
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T", function.Body.Statements[0])
+	}
+	if bodyStmt.Expression.String() != "(x + y)" {
+		t.Errorf("function body wrong. want %q, got=%q", "(x + y)", bodyStmt.Expression.String())
+	}
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{input: "fn() {};", expectedParams: []string{}},
+		{input: "fn(x) {};", expectedParams: []string{"x"}},
+		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d\n", len(tt.expectedParams), len(function.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			if function.Parameters[i].Value != ident {
+				t.Errorf("parameter %d wrong. want %s, got=%s\n", i, ident, function.Parameters[i].Value)
+			}
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	input := "add(1, 2 * 3, 4 + 5);"
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+	if exp.Function.String() != "add" {
+		t.Errorf("exp.Function wrong. want %q, got=%q", "add", exp.Function.String())
+	}
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+	testIntegerLiteral(t, exp.Arguments[0], 1)
+	for i, expected := range []string{"1", "(2 * 3)", "(4 + 5)"} {
+		if exp.Arguments[i].String() != expected {
+			t.Errorf("argument %d wrong. want %q, got=%q", i, expected, exp.Arguments[i].String())
+		}
+	}
+}
+
+func TestCallExpressionPrecedenceParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a + add(b * c) + d;", "((a + add((b * c))) + d);"},
+		{"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8));", "add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)));"},
+		{"add(a + b + c * d / f + g);", "add((((a + b) + ((c * d) / f)) + g));"},
+		{"-add(1);", "(-add(1));"},
+		{"let add = fn(x, y) { x + y; }; add(1, 2);", "let add = fn(x, y) { (x + y); };add(1, 2);"},
+		{"fn(x) { x; }(5);", "fn(x) { x; }(5);"},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestFunctionParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"fn(x, 5) { x; };", []string{"1:7: expected next token to be IDENT, got INT instead"}},
+		{"fn(x { x; };", []string{"1:6: expected next token to be ), got { instead"}},
+		{"let f = fn(x) { x; ", []string{"1:20: expected next token to be }, got EOF instead"}},
+		{"add(1, 2;", []string{"1:9: expected next token to be ), got ; instead"}},
+		// errors inside a body are reported, but do not stop the rest of the body from being parsed.
+		{"fn(x) { let = 1; x + ; };", []string{
+			"1:13: expected next token to be IDENT, got = instead",
+			"1:22: no prefix parse function for ; found",
+		}},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		_ = p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expected) {
+			for _, msg := range errors {
+				t.Logf("parser error: %q", msg)
+			}
+			t.Fatalf("\n number of errors mismatch for %q. \ngot %#+v \nwanted %#+v", tt.input, len(errors), len(tt.expected))
+		}
+		for i, expected := range tt.expected {
+			if errors[i].Error() != expected {
+				t.Errorf("\n wrong error. \ngot %q \nwanted %q", errors[i], expected)
+			}
+		}
+	}
+}
+
+func TestBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedBoolean bool
+	}{
+		{"true;", true},
+		{"false;", false},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program has not enough statements. got=%d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+		boolean, ok := stmt.Expression.(*ast.Boolean)
+		if !ok {
+			t.Fatalf("exp not *ast.Boolean. got=%T", stmt.Expression)
+		}
+		if boolean.Value != tt.expectedBoolean {
+			t.Errorf("boolean.Value not %t. got=%t", tt.expectedBoolean, boolean.Value)
+		}
+	}
+}
+
+func TestGroupedAndBooleanPrecedenceParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"true;", "true;"},
+		{"3 > 5 == false;", "((3 > 5) == false);"},
+		{"3 < 5 == true;", "((3 < 5) == true);"},
+		{"!true;", "(!true);"},
+		{"1 + (2 + 3) + 4;", "((1 + (2 + 3)) + 4);"},
+		{"(5 + 5) * 2;", "((5 + 5) * 2);"},
+		{"2 / (5 + 5);", "(2 / (5 + 5));"},
+		{"-(5 + 5);", "(-(5 + 5));"},
+		{"!(true == true);", "(!(true == true));"},
+		{"add(a * (b + c));", "add((a * (b + c)));"},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestIfExpression(t *testing.T) {
+	input := `if (x < y) { x; }`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+	if exp.Condition.String() != "(x < y)" {
+		t.Errorf("exp.Condition wrong. want %q, got=%q", "(x < y)", exp.Condition.String())
+	}
+	if len(exp.Consequence.Statements) != 1 {
+		t.Errorf("consequence is not 1 statements. got=%d\n", len(exp.Consequence.Statements))
+	}
+	if exp.Alternative != nil {
+		t.Errorf("exp.Alternative was not nil. got=%+v", exp.Alternative)
+	}
+}
+
+func TestIfElseExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (x < y) { x; } else { y; }", "if ((x < y)) { x; } else { y; }"},
+		{"if (x < y) { x; } else { y; };", "if ((x < y)) { x; } else { y; }"},
+		{"let max = if (x > y) { x; } else { y; };", "let max = if ((x > y)) { x; } else { y; };"},
+		// an if that starts a statement is not the left side of an infix expression.
+		{"if (x) { 1; } -1;", "if (x) { 1; }(-1);"},
+		{"if (x) { 1; } if (y) { 2; }", "if (x) { 1; }if (y) { 2; }"},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestIfExpressionParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if x { x; }", "1:4: expected next token to be (, got IDENT instead"},
+		{"if (x { x; }", "1:7: expected next token to be ), got { instead"},
+		{"if (x) x;", "1:8: expected next token to be {, got IDENT instead"},
+		{"if (x) { x; } else y;", "1:20: expected next token to be {, got IDENT instead"},
+		{"(1 + 2;", "1:7: expected next token to be ), got ; instead"},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		_ = p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			for _, msg := range errors {
+				t.Logf("parser error: %q", msg)
+			}
+			t.Fatalf("\n number of errors mismatch for %q. \ngot %#+v \nwanted %#+v", tt.input, len(errors), 1)
+		}
+		if errors[0].Error() != tt.expected {
+			t.Errorf("\n wrong error. \ngot %q \nwanted %q", errors[0], tt.expected)
+		}
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello\tworld";`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != "hello\tworld" {
+		t.Errorf("literal.Value not %q. got=%q", "hello\tworld", literal.Value)
+	}
+	if literal.String() != `"hello\tworld"` {
+		t.Errorf("literal.String() not %q. got=%q", `"hello\tworld"`, literal.String())
+	}
+}
+
+func TestIllegalTokenParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let s = "foo;`, "1:9: string literal not terminated"},
+		{`let s = "a\qb";`, `1:11: unknown escape sequence \q`},
+		{`let s = @;`, `1:9: unexpected character '@'`},
+		{`0x;`, "1:2: hexadecimal literal has no digits"},
+		{`0b102;`, "1:5: invalid digit '2' in binary literal"},
+		{`1e;`, "1:2: exponent has no digits"},
+		{`1.5e+;`, "1:4: exponent has no digits"},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		_ = p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			for _, msg := range errors {
+				t.Logf("parser error: %q", msg)
+			}
+			t.Fatalf("\n number of errors mismatch for %q. \ngot %#+v \nwanted %#+v", tt.input, len(errors), 1)
+		}
+		if errors[0].Kind != IllegalToken {
+			t.Errorf("\n wrong Kind. \ngot %s \nwanted %s", errors[0].Kind, IllegalToken)
+		}
+		if errors[0].Error() != tt.expected {
+			t.Errorf("\n wrong error. \ngot %q \nwanted %q", errors[0], tt.expected)
+		}
+	}
+}
+
+func TestCommentsAreIgnored(t *testing.T) {
+	input := `
+	// the answer
+	let x = 42; /* not 41 */
+	let add = fn(a, /* b */ c) { // adds
+		a + c;
+	};
+	`
+	for _, keepComments := range []bool{false, true} {
+		l := lexer.NewLexer(input)
+		l.KeepComments = keepComments
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		expected := "let x = 42;let add = fn(a, c) { (a + c); };"
+		if program.String() != expected {
+			t.Errorf("expected=%q, got=%q", expected, program.String())
+		}
+	}
+}
+
+func BenchmarkParseProgram(b *testing.B) {
+	b.SetBytes(int64(len(testcorpus.Benchmark)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p := NewParser(lexer.NewLexer(testcorpus.Benchmark))
+		p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			b.Fatalf("parser errors: %q", p.Errors())
+		}
+	}
+}
+
+func TestConcurrentParser(t *testing.T) {
+	tests := []string{
+		"let x = 5; let y = add(x, 2 * 3);",
+		"if (x < y) { x; } else { y; } // the end",
+		`let s = "bad \q escape"; let = 5; let z = 1__0; fn(x, 5) { x; };`,
+		testcorpus.Benchmark,
+	}
+	for _, input := range tests {
+		p := NewParser(lexer.NewLexer(input))
+		expected := p.ParseProgram()
+
+		cp := NewConcurrentParser(context.Background(), lexer.NewLexer(input))
+		got := cp.ParseProgram()
+		if got.String() != expected.String() {
+			t.Fatalf("\n program mismatch for %q. \ngot %q \nwanted %q", input, got.String(), expected.String())
+		}
+		if fmt.Sprint(cp.Errors()) != fmt.Sprint(p.Errors()) {
+			t.Errorf("\n errors mismatch for %q. \ngot %q \nwanted %q", input, cp.Errors(), p.Errors())
+		}
+	}
+}
+
+func TestConcurrentParserCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := NewConcurrentParser(ctx, lexer.NewLexer(testcorpus.Benchmark))
+	_ = p.ParseProgram()
+
+	errs := p.Errors()
+	if len(errs) == 0 {
+		t.Fatalf("\n No errors found after cancel.")
+	}
+	last := errs[len(errs)-1]
+	if last.Kind != Canceled {
+		t.Errorf("\n wrong Kind. \ngot %s \nwanted %s", last.Kind, Canceled)
+	}
+	if last.Msg != context.Canceled.Error() {
+		t.Errorf("\n wrong Msg. \ngot %q \nwanted %q", last.Msg, context.Canceled.Error())
+	}
+}
+
+func TestConcurrentParserStopsLexer(t *testing.T) {
+	before := runtime.NumGoroutine()
+	p := NewConcurrentParser(context.Background(), lexer.NewLexer(testcorpus.Benchmark))
+	// make ParseProgram stop reading tokens long before the end of the input, like a bug in the parser would.
+	next, n := p.next, 0
+	p.next = func() token.Token {
+		if n++; n > 100 {
+			panic("parser bug")
+		}
+		return next()
+	}
+	func() {
+		defer func() { recover() }()
+		p.ParseProgram()
+	}()
+
+	// the lexer goroutine, which was blocked on sending the next token, is gone.
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > before; {
+		if time.Now().After(deadline) {
+			t.Fatalf("\n lexer goroutine was not stopped. \ngot %d goroutines \nwanted %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,206 @@
+package parser
+
+import (
+	"math/big"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/komuw/cali/ast"
+	"github.com/komuw/cali/lexer"
+	"github.com/komuw/cali/token"
+)
+
+/*
+The String of an AST is cali source code. Parsing it has to give back the same AST(see ast.Equal); else either String or
+the parser has a bug. Instead of writing such programs by hand, we generate random ones.
+*/
+
+// roundTrip checks that the String of program parses to a program that is Equal to it.
+func roundTrip(t *testing.T, program *ast.Program) {
+	t.Helper()
+	src := program.String()
+	p := NewParser(lexer.NewLexer(src))
+	got := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("\n could not parse the String of a program. \nsource %q \nerrors %q", src, p.Errors())
+	}
+	if !ast.Equal(got, program) {
+		t.Fatalf("\n the String of a program parses to a different program. \nsource %q \ngot %q", src, got.String())
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for seed := int64(0); seed < 2000; seed++ {
+		roundTrip(t, newGenerator(seed).program())
+	}
+}
+
+// TestRoundTripSource is for programs that the generator does not make, or did not make when they were found to fail.
+func TestRoundTripSource(t *testing.T) {
+	tests := []string{
+		"\"\x8d\";",
+		`"\x8D";`,
+		"\"a\xffb\xe5\x90\" + \"\xe5\x90\x8d\";",
+		`"\u{0}\u{200B}\u{1F600}";`,
+	}
+	for _, input := range tests {
+		p := NewParser(lexer.NewLexer(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("\n parser errors for %q: %q", input, p.Errors())
+		}
+		roundTrip(t, program)
+	}
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	for seed := int64(0); seed < 16; seed++ {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, seed int64) {
+		roundTrip(t, newGenerator(seed).program())
+	})
+}
+
+// generator makes random ASTs of valid programs. The same seed always gives the same AST.
+type generator struct {
+	r *rand.Rand
+}
+
+func newGenerator(seed int64) *generator {
+	return &generator{r: rand.New(rand.NewSource(seed))}
+}
+
+// maxDepth is how deeply the expressions of a generated program nest; it keeps the programs small.
+const maxDepth = 4
+
+// some of the identifiers start like keywords, to check that the lexer does not take them for one.
+var generatorIdentifiers = []string{"a", "b", "x", "y", "add", "_tmp", "नमस्ते", "名前", "letter", "iffy", "fnord", "returned", "trueish"}
+
+var generatorOperators = []token.TokenType{token.PLUS, token.MINUS, token.ASTERISK, token.SLASH, token.LT, token.GT, token.EQ, token.NOT_EQ}
+
+// generatorRunes are the chars of generated strings; including the ones that have to be escaped.
+var generatorRunes = []rune{'a', 'Z', ' ', '"', '\\', '\n', '\t', '\r', 0, 'é', '名', '\u200b', '\U0001F600', '{', '}'}
+
+// generatorBytes are the bytes of generated strings that are not valid UTF-8; on their own, or next to other bytes.
+var generatorBytes = []byte{0x8d, 0xff, 0xe5, 0x90}
+
+func (g *generator) program() *ast.Program {
+	return &ast.Program{Statements: g.statements(g.r.Intn(6), maxDepth)}
+}
+
+func (g *generator) statements(n, depth int) []ast.Statement {
+	stmts := []ast.Statement{}
+	for i := 0; i < n; i++ {
+		stmts = append(stmts, g.statement(depth))
+	}
+	return stmts
+}
+
+func (g *generator) statement(depth int) ast.Statement {
+	switch g.r.Intn(4) {
+	case 0:
+		return &ast.LetStatement{Token: tok(token.LET, "let"), Name: g.identifier(), Value: g.expression(depth)}
+	case 1:
+		return &ast.ReturnStatement{Token: tok(token.RETURN, "return"), ReturnValue: g.expression(depth)}
+	}
+	return &ast.ExpressionStatement{Expression: g.expression(depth)}
+}
+
+func (g *generator) block(depth int) *ast.BlockStatement {
+	return &ast.BlockStatement{Token: tok(token.LBRACE, "{"), Statements: g.statements(g.r.Intn(3), depth)}
+}
+
+func (g *generator) expression(depth int) ast.Expression {
+	if depth <= 0 {
+		return g.literal()
+	}
+	depth--
+	switch g.r.Intn(9) {
+	case 0:
+		if g.r.Intn(2) == 0 {
+			return &ast.PrefixExpression{Token: tok(token.MINUS, "-"), Operator: "-", Right: g.expression(depth)}
+		}
+		return &ast.PrefixExpression{Token: tok(token.BANG, "!"), Operator: "!", Right: g.expression(depth)}
+	case 1, 2:
+		op := generatorOperators[g.r.Intn(len(generatorOperators))]
+		return &ast.InfixExpression{Token: tok(op, op.String()), Operator: op.String(), Left: g.expression(depth), Right: g.expression(depth)}
+	case 3:
+		call := &ast.CallExpression{Token: tok(token.LPAREN, "("), Function: g.expression(depth), Arguments: []ast.Expression{}}
+		for i := g.r.Intn(4); i > 0; i-- {
+			call.Arguments = append(call.Arguments, g.expression(depth))
+		}
+		return call
+	case 4:
+		fn := &ast.FunctionLiteral{Token: tok(token.FUNCTION, "fn"), Parameters: []*ast.Identifier{}}
+		for i := g.r.Intn(4); i > 0; i-- {
+			fn.Parameters = append(fn.Parameters, g.identifier())
+		}
+		fn.Body = g.block(depth)
+		return fn
+	case 5:
+		ifExp := &ast.IfExpression{Token: tok(token.IF, "if"), Condition: g.expression(depth), Consequence: g.block(depth)}
+		if g.r.Intn(2) == 0 {
+			ifExp.Alternative = g.block(depth)
+		}
+		return ifExp
+	}
+	return g.literal()
+}
+
+func (g *generator) literal() ast.Expression {
+	switch g.r.Intn(6) {
+	case 0:
+		return g.integer()
+	case 1:
+		// 'g' formats some floats without a . or an exponent; those would be lexed as integers.
+		s := strconv.FormatFloat(g.r.ExpFloat64()*float64(g.r.Intn(1e6)), 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		value, _ := strconv.ParseFloat(s, 64)
+		return &ast.FloatLiteral{Token: tok(token.FLOAT, s), Value: value}
+	case 2:
+		var s strings.Builder
+		for i := g.r.Intn(6); i > 0; i-- {
+			if g.r.Intn(8) == 0 {
+				s.WriteByte(generatorBytes[g.r.Intn(len(generatorBytes))])
+				continue
+			}
+			s.WriteRune(generatorRunes[g.r.Intn(len(generatorRunes))])
+		}
+		return &ast.StringLiteral{Token: tok(token.STRING, s.String()), Value: s.String()}
+	case 3:
+		if g.r.Intn(2) == 0 {
+			return &ast.Boolean{Token: tok(token.TRUE, "true"), Value: true}
+		}
+		return &ast.Boolean{Token: tok(token.FALSE, "false"), Value: false}
+	}
+	return g.identifier()
+}
+
+// integer returns an integer literal; in decimal or hex, and sometimes one too big for an int64
+func (g *generator) integer() *ast.IntegerLiteral {
+	switch g.r.Intn(4) {
+	case 0:
+		n := g.r.Int63()
+		return &ast.IntegerLiteral{Token: tok(token.INT, "0x"+strconv.FormatInt(n, 16)), Value: n}
+	case 1:
+		n := new(big.Int).Lsh(big.NewInt(1), uint(63+g.r.Intn(64)))
+		n.Add(n, big.NewInt(g.r.Int63()))
+		return &ast.IntegerLiteral{Token: tok(token.INT, n.String()), Big: n}
+	}
+	n := g.r.Int63n(1000)
+	return &ast.IntegerLiteral{Token: tok(token.INT, strconv.FormatInt(n, 10)), Value: n}
+}
+
+func (g *generator) identifier() *ast.Identifier {
+	name := generatorIdentifiers[g.r.Intn(len(generatorIdentifiers))]
+	return &ast.Identifier{Token: tok(token.IDENT, name), Value: name}
+}
+
+func tok(t token.TokenType, value string) token.Token {
+	return token.Token{Type: t, Value: value}
+}
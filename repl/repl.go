@@ -5,38 +5,60 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/komuw/cali/eval"
 	"github.com/komuw/cali/lexer"
-	"github.com/komuw/cali/token"
+	"github.com/komuw/cali/object"
+	"github.com/komuw/cali/parser"
 )
 
 /*
 A REPL(“Read Eval Print Loop) reads input, sends it to the interpreter for evaluation, prints the result/output of the
 interpreter and starts again.
 
-We don’t know how to fully “Eval” cali source code yet. We only have one part of the
-process that hides behind “Eval”: we can tokenize cali source code.
+Every line is lexed, parsed and evaluated. The environment is created once and shared by all the lines,
+so a binding made on one line is available on the next;
+	>> let x = 5;
+	>> x * 2;
+	10
 */
 
 const PROMPT = ">> "
 
+/*
+Start runs the REPL until in is exhausted.
+Everything, including the prompt, is written to out. So the REPL can be embedded in other programs and tested.
+*/
 func Start(in io.Reader, out io.Writer) {
-	/*
-		This tokenizes cali source code and prints the tokens.
-		Later on, we will expand on this and add parsing and evaluation to it.
-	*/
 	scanner := bufio.NewScanner(in)
+	env := object.NewEnvironment()
 
 	for {
-		fmt.Printf(PROMPT)
+		fmt.Fprint(out, PROMPT)
 		scanned := scanner.Scan()
 		if !scanned {
 			return
 		}
 		line := scanner.Text()
 		l := lexer.NewLexer(line)
-		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-			fmt.Printf("%+v\n", tok)
+		p := parser.NewParser(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			printParserErrors(out, line, p.Errors())
+			continue
+		}
+
+		evaluated := eval.Eval(program, env)
+		if evaluated != nil {
+			io.WriteString(out, evaluated.Inspect())
+			io.WriteString(out, "\n")
 		}
 	}
+}
 
+// printParserErrors prints every error together with the line it occurred on; see parser.Error.Snippet
+func printParserErrors(out io.Writer, line string, errors parser.ErrorList) {
+	for _, e := range errors {
+		io.WriteString(out, e.Snippet(line))
+		io.WriteString(out, "\n")
+	}
 }
@@ -0,0 +1,28 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + 5;\n", ">> 10\n>> "},
+		{"let x = 5;\nx * 2;\n", ">> >> 10\n>> "},
+		{"let add = fn(a, b) { a + b; };\nadd(1, 2);\n", ">> >> 3\n>> "},
+		{"let = 5;\n", ">> 1:5: expected next token to be IDENT, got = instead\nlet = 5;\n    ^\n>> "},
+		{"x;\nlet x = 1;\nx;\n", ">> ERROR: 1:1: identifier not found: x\n>> >> 1\n>> "},
+		{"if (false) { 1; }\n", ">> null\n>> "},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+		if out.String() != tt.expected {
+			t.Errorf("\n wrong output for %q. \ngot %q \nwanted %q", tt.input, out.String(), tt.expected)
+		}
+	}
+}
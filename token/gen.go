@@ -0,0 +1,76 @@
+//go:build ignore
+
+/*
+gen.go writes tokentype_string.go; the table of the names of the token types that TokenType.String uses.
+Run it with go generate. TestTokensGenerated fails if tokentype_string.go is out of date.
+
+	go run gen.go [-o file]    writes to file, tokentype_string.go by default
+*/
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+	out := flag.String("o", "tokentype_string.go", "file to write to")
+	flag.Parse()
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "token.go", nil, parser.ParseComments)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by gen.go; DO NOT EDIT.\n\npackage token\n\n")
+	buf.WriteString("// tokens is the table that String() uses; see gen.go\n")
+	buf.WriteString("var tokens = [NumTokens]string{\n")
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST || !isTokenTypes(gen) {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			for _, name := range spec.(*ast.ValueSpec).Names {
+				if name.Name == "NumTokens" {
+					continue
+				}
+				// like stringer -linecomment, the line comment is the name if there is one.
+				value := name.Name
+				if c := spec.(*ast.ValueSpec).Comment; c != nil {
+					value = strings.TrimSpace(c.Text())
+				}
+				fmt.Fprintf(&buf, "\t%s: %q,\n", name.Name, value)
+			}
+		}
+	}
+	buf.WriteString("}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// isTokenTypes reports whether gen is the const block of the token types; the one that starts with ILLEGAL TokenType = iota
+func isTokenTypes(gen *ast.GenDecl) bool {
+	if len(gen.Specs) == 0 {
+		return false
+	}
+	spec := gen.Specs[0].(*ast.ValueSpec)
+	typ, ok := spec.Type.(*ast.Ident)
+	return ok && typ.Name == "TokenType"
+}
@@ -1,5 +1,7 @@
 package token
 
+import "fmt"
+
 /*
 LEXING
 
@@ -23,6 +25,7 @@ what exactly constitutes a "token" varies between different lexer implementation
 A production-ready lexer might also attach the line number, column number and filename to
 a token. A reason may be so that we can output useful error messages in the parsing stage:
   "error: expected semicolon token. line 42, column 23, program.cali"
+The cali lexer does this; see Position.
 
 2. Define tokens
 	let five = 5; //1. numbers like 5
@@ -33,62 +36,155 @@ a token. A reason may be so that we can output useful error messages in the pars
 
 */
 
-// TokenType is a string. But using an int or byte would have better performance
-type TokenType string
+/*
+TokenType is an int and not a string; comparing ints and using them as array indices(see parser.Parser)
+is a lot cheaper than comparing and hashing strings.
+String() returns the name of the token type; see tokens.
+*/
+type TokenType int
+
+/*
+Position is a location in cali source code. It is what lets us produce error messages like;
+
+	"error: expected semicolon token. program.cali:42:23"
+
+Offset is the byte offset into the input, starting at 0.
+Line and Column both start at 1. Column is counted in chars(runes) and not bytes, so that it matches what editors show.
+A Position with a Line of 0 is invalid; eg the position of a token that was not produced by the lexer.
+*/
+type Position struct {
+	Filename string `json:"filename,omitempty"`
+	Offset   int    `json:"offset"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+// IsValid reports whether the position was set by the lexer.
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+/*
+String returns the position in one of the forms;
+
+	file:line:column    if there is a filename
+	line:column         if there is no filename
+	-                   if the position is invalid
+*/
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.Filename != "" {
+			return p.Filename
+		}
+		return "-"
+	}
+	s := fmt.Sprintf("%d:%d", p.Line, p.Column)
+	if p.Filename != "" {
+		s = p.Filename + ":" + s
+	}
+	return s
+}
 
 /*
 Token needs
 1. “type” attribute, so we can distinguish between “integers” and “right bracket” for example.
 2. field that holds the literal value of the token, so we can reuse it later and the info whether a “number” token is a 5 or a 10 doesn’t get lost.
+3. the positions where the token starts and ends in the source code, so that errors can point at it.
 */
 type Token struct {
-	Type  TokenType
-	Value string
+	Type  TokenType `json:"type"`
+	Value string    `json:"value"`
+	Pos   Position  `json:"pos"` // where the token starts in the source
+	End   Position  `json:"end"` // position immediately after the token
 }
 
 // NewToken creates new token
-func NewToken(tokenType TokenType, ch byte) Token {
+func NewToken(tokenType TokenType, ch rune) Token {
 	return Token{Type: tokenType, Value: string(ch)}
 }
 
+/*
+The name of a token type(see String) is its line comment, or its constant name if it has none; the same as
+stringer -linecomment does. Operators and delimiters are named by how they appear in cali source code.
+tokentype_string.go is generated from these; run go generate after adding a token type.
+*/
+//go:generate go run gen.go
 const (
-	ILLEGAL = "ILLEGAL"
-	EOF     = "EOF"
-
-	// Identifiers + literals
-	IDENT = "IDENT" // add, foobar, x, y, ...
-	INT   = "INT"   // 1343456
-
-	// Operators
-	ASSIGN   = "="
-	PLUS     = "+"
-	MINUS    = "-"
-	BANG     = "!"
-	ASTERISK = "*"
-	SLASH    = "/"
-	LT       = "<"
-	GT       = ">"
-	EQ       = "==" // EQ and NOT_EQ require the use of lookAhead
-	NOT_EQ   = "!="
+	ILLEGAL TokenType = iota
+	EOF
+
+	// Identifiers + literals; eg add, 1343456, 13.43456 and "hello world"
+	IDENT
+	INT
+	FLOAT
+	STRING
+
+	// COMMENT is only produced when the lexer is asked to keep comments; see lexer.Lexer.KeepComments
+	COMMENT
+
+	// Operators. EQ and NOT_EQ require the use of lookAhead
+	ASSIGN   // =
+	PLUS     // +
+	MINUS    // -
+	BANG     // !
+	ASTERISK // *
+	SLASH    // /
+	LT       // <
+	GT       // >
+	EQ       // ==
+	NOT_EQ   // !=
 
 	// Delimiters
-	COMMA     = ","
-	SEMICOLON = ";"
-	LPAREN    = "("
-	RPAREN    = ")"
-	LBRACE    = "{"
-	RBRACE    = "}"
+	COMMA     // ,
+	SEMICOLON // ;
+	LPAREN    // (
+	RPAREN    // )
+	LBRACE    // {
+	RBRACE    // }
 
 	// Keywords
-	FUNCTION = "FUNCTION"
-	LET      = "LET"
-	TRUE     = "TRUE"
-	FALSE    = "FALSE"
-	IF       = "IF"
-	ELSE     = "ELSE"
-	RETURN   = "RETURN"
+	FUNCTION
+	LET
+	TRUE
+	FALSE
+	IF
+	ELSE
+	RETURN
+
+	// NumTokens is the number of token types. It is not a token type itself; it is used to size
+	// tables that are indexed by TokenType, like the one in String()
+	NumTokens
 )
 
+// String returns the name of the token type; eg "IDENT" for IDENT and "+" for PLUS
+func (t TokenType) String() string {
+	if 0 <= t && t < NumTokens {
+		return tokens[t]
+	}
+	return fmt.Sprintf("TokenType(%d)", int(t))
+}
+
+/*
+MarshalText encodes the token type as its name; see String.
+So that token types in JSON(see ast.Program.MarshalJSON) read as "IDENT" and "+" instead of numbers that change
+whenever a token type is added.
+*/
+func (t TokenType) MarshalText() ([]byte, error) {
+	if t < 0 || t >= NumTokens {
+		return nil, fmt.Errorf("token: can not encode unknown token type %d", int(t))
+	}
+	return []byte(tokens[t]), nil
+}
+
+// UnmarshalText decodes a token type from its name, as encoded by MarshalText.
+func (t *TokenType) UnmarshalText(text []byte) error {
+	for i, name := range tokens {
+		if name == string(text) {
+			*t = TokenType(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("token: unknown token type %q", text)
+}
+
 var keywords = map[string]TokenType{
 	"fn":     FUNCTION,
 	"let":    LET,
@@ -0,0 +1,60 @@
+package token
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+/*
+Check that every token type has a name, and that no two token types got the same name; String would be wrong for them
+and UnmarshalText would decode one as the other.
+*/
+func TestTokenNames(t *testing.T) {
+	seen := make(map[string]TokenType)
+	for tt := TokenType(0); tt < NumTokens; tt++ {
+		name := tt.String()
+		if name == "" {
+			t.Errorf("\n token type %d has no name in tokens", int(tt))
+			continue
+		}
+		if other, ok := seen[name]; ok {
+			t.Errorf("\n token types %d and %d have the same name %q", int(other), int(tt), name)
+		}
+		seen[name] = tt
+
+		var decoded TokenType
+		if err := decoded.UnmarshalText([]byte(name)); err != nil || decoded != tt {
+			t.Errorf("\n %q does not decode to token type %d. \ngot %d, %v", name, int(tt), int(decoded), err)
+		}
+	}
+
+	if name, expected := NumTokens.String(), fmt.Sprintf("TokenType(%d)", int(NumTokens)); name != expected {
+		t.Errorf("\n wrong name for a token type that is out of range. \ngot %q \nwanted %q", name, expected)
+	}
+}
+
+// tokentype_string.go has to be generated again whenever a token type is added; see gen.go
+func TestTokensGenerated(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	generated := filepath.Join(t.TempDir(), "tokentype_string.go")
+	if out, err := exec.Command("go", "run", "gen.go", "-o", generated).CombinedOutput(); err != nil {
+		t.Fatalf("\n gen.go failed: %v \n%s", err, out)
+	}
+	expected, err := os.ReadFile(generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("tokentype_string.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("\n tokentype_string.go is out of date; run go generate ./token")
+	}
+}